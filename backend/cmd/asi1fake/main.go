@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"dex-analyzer/internal/asi1fake"
+)
+
+func main() {
+	port := flag.String("port", "8090", "Port to run the fake ASI1 server on")
+	scriptPath := flag.String("script", "", "JSON file with scripted replies (defaults to a single valid tool call)")
+	apiKey := flag.String("api-key", "", "Bearer token to require from clients (optional)")
+	flag.Parse()
+
+	var script []asi1fake.Reply
+	if *scriptPath != "" {
+		var err error
+		script, err = asi1fake.LoadScript(*scriptPath)
+		if err != nil {
+			log.Fatalf("Error loading script: %v", err)
+		}
+	}
+
+	address := fmt.Sprintf(":%s", *port)
+	log.Printf("Fake ASI1 listening on %s, set ASI_ONE_BASE_URL=http://localhost%s/v1", address, address)
+	if err := http.ListenAndServe(address, asi1fake.NewServer(*apiKey, script...)); err != nil {
+		log.Fatalf("Error starting fake ASI1 server: %v", err)
+	}
+}
@@ -5,11 +5,19 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
 	"dex-analyzer/internal/api"
+	"dex-analyzer/internal/ens"
+	"dex-analyzer/internal/prompts"
+	"dex-analyzer/internal/risk"
+	"dex-analyzer/internal/snapshots"
+	"dex-analyzer/internal/tokens"
+	"dex-analyzer/internal/upstream"
 )
 
 // getEnvOrDefault gets an environment variable or returns a default value
@@ -27,10 +35,250 @@ func main() {
 	}
 
 	port := flag.String("port", getEnvOrDefault("PORT", "8080"), "Port to run the server on")
+	defaultEngine := flag.String("engine", getEnvOrDefault("RISK_ENGINE", api.EngineASI1), "Default risk engine (asi1, llm, agent or native)")
 	flag.Parse()
 
+	// Initialize the retry and circuit breaker policy shared by all upstreams
+	upstreamTimeout, err := time.ParseDuration(getEnvOrDefault("UPSTREAM_TIMEOUT", upstream.DefaultTimeout.String()))
+	if err != nil {
+		log.Fatalf("Invalid UPSTREAM_TIMEOUT: %v", err)
+	}
+	llmTimeout, err := time.ParseDuration(getEnvOrDefault("LLM_TIMEOUT", "60s"))
+	if err != nil {
+		log.Fatalf("Invalid LLM_TIMEOUT: %v", err)
+	}
+	upstreamMaxAttempts, err := strconv.Atoi(getEnvOrDefault("UPSTREAM_MAX_ATTEMPTS", "0"))
+	if err != nil {
+		log.Fatalf("Invalid UPSTREAM_MAX_ATTEMPTS: %v", err)
+	}
+	upstreamBaseDelay, err := time.ParseDuration(getEnvOrDefault("UPSTREAM_BASE_DELAY", upstream.DefaultBaseDelay.String()))
+	if err != nil {
+		log.Fatalf("Invalid UPSTREAM_BASE_DELAY: %v", err)
+	}
+	upstreamMaxDelay, err := time.ParseDuration(getEnvOrDefault("UPSTREAM_MAX_DELAY", upstream.DefaultMaxDelay.String()))
+	if err != nil {
+		log.Fatalf("Invalid UPSTREAM_MAX_DELAY: %v", err)
+	}
+	breakerThreshold, err := strconv.Atoi(getEnvOrDefault("UPSTREAM_BREAKER_THRESHOLD", "0"))
+	if err != nil {
+		log.Fatalf("Invalid UPSTREAM_BREAKER_THRESHOLD: %v", err)
+	}
+	breakerCooldown, err := time.ParseDuration(getEnvOrDefault("UPSTREAM_BREAKER_COOLDOWN", upstream.DefaultCooldown.String()))
+	if err != nil {
+		log.Fatalf("Invalid UPSTREAM_BREAKER_COOLDOWN: %v", err)
+	}
+	// Every upstream gets its own client so one failing API does not trip
+	// the breaker of the others
+	newUpstream := func(name string, timeout time.Duration) *upstream.Client {
+		return upstream.NewClient(upstream.Config{
+			Name:             name,
+			Timeout:          timeout,
+			MaxAttempts:      upstreamMaxAttempts,
+			BaseDelay:        upstreamBaseDelay,
+			MaxDelay:         upstreamMaxDelay,
+			FailureThreshold: breakerThreshold,
+			Cooldown:         breakerCooldown,
+		})
+	}
+
+	// Initialize portfolio provider
+	zapperAPIKey := os.Getenv("ZAPPER_API_KEY")
+	zapperMode := getEnvOrDefault("ZAPPER_MODE", api.ZapperModeLive)
+	if zapperAPIKey == "" && zapperMode != api.ZapperModeReplay {
+		log.Println("ZAPPER_API_KEY is not set, portfolio requests to Zapper will fail")
+	}
+	zapperPageSize, err := strconv.Atoi(getEnvOrDefault("ZAPPER_PAGE_SIZE", "0"))
+	if err != nil {
+		log.Fatalf("Invalid ZAPPER_PAGE_SIZE: %v", err)
+	}
+	zapperMaxItems, err := strconv.Atoi(getEnvOrDefault("ZAPPER_MAX_ITEMS", "0"))
+	if err != nil {
+		log.Fatalf("Invalid ZAPPER_MAX_ITEMS: %v", err)
+	}
+	zapperTimeout, err := time.ParseDuration(getEnvOrDefault("ZAPPER_TIMEOUT", api.DefaultZapperTimeout.String()))
+	if err != nil {
+		log.Fatalf("Invalid ZAPPER_TIMEOUT: %v", err)
+	}
+	portfolio, err := api.NewZapperProvider(api.ZapperConfig{
+		APIKey:      zapperAPIKey,
+		PageSize:    zapperPageSize,
+		MaxItems:    zapperMaxItems,
+		Mode:        zapperMode,
+		FixturesDir: os.Getenv("ZAPPER_FIXTURES_DIR"),
+		Timeout:     zapperTimeout,
+		HTTPClient:  newUpstream("zapper", upstreamTimeout),
+	})
+	if err != nil {
+		log.Fatalf("Error initializing Zapper provider: %v", err)
+	}
+
+	// Initialize risk engines selectable with ?engine=
+	asi1MaxAttempts, err := strconv.Atoi(getEnvOrDefault("ASI1_MAX_ATTEMPTS", "0"))
+	if err != nil {
+		log.Fatalf("Invalid ASI1_MAX_ATTEMPTS: %v", err)
+	}
+
+	// Initialize versioned prompt templates for the LLM engines
+	promptLibrary, err := prompts.Load(os.Getenv("PROMPTS_DIR"))
+	if err != nil {
+		log.Fatalf("Error loading prompt templates: %v", err)
+	}
+	promptVariants, err := prompts.ParseVariants(os.Getenv("PROMPT_VERSIONS"))
+	if err != nil {
+		log.Fatalf("Invalid PROMPT_VERSIONS: %v", err)
+	}
+	promptTokenBudget, err := strconv.Atoi(getEnvOrDefault("PROMPT_TOKEN_BUDGET", "0"))
+	if err != nil {
+		log.Fatalf("Invalid PROMPT_TOKEN_BUDGET: %v", err)
+	}
+	promptDustUSD, err := strconv.ParseFloat(getEnvOrDefault("PROMPT_DUST_USD", "0"), 64)
+	if err != nil {
+		log.Fatalf("Invalid PROMPT_DUST_USD: %v", err)
+	}
+	promptTopN, err := strconv.Atoi(getEnvOrDefault("PROMPT_TOP_N", "0"))
+	if err != nil {
+		log.Fatalf("Invalid PROMPT_TOP_N: %v", err)
+	}
+	promptBuilder, err := prompts.NewBuilder(promptLibrary, promptVariants, prompts.CompactionConfig{
+		TokenBudget: promptTokenBudget,
+		DustUSD:     promptDustUSD,
+		TopN:        promptTopN,
+	})
+	if err != nil {
+		log.Fatalf("Error initializing prompt builder: %v", err)
+	}
+
+	nativeEngine := risk.NewEngine()
+	asi1Engine, err := api.NewASI1Engine(api.ASI1Config{
+		APIKey:      os.Getenv("ASI_ONE_API_KEY"),
+		BaseURL:     os.Getenv("ASI_ONE_BASE_URL"),
+		Model:       os.Getenv("ASI_ONE_MODEL"),
+		MaxAttempts: asi1MaxAttempts,
+		Fallback:    nativeEngine,
+		Prompts:     promptBuilder,
+		HTTPClient:  newUpstream("ASI1", llmTimeout),
+	})
+	if err != nil {
+		log.Fatalf("Error initializing ASI1 engine: %v", err)
+	}
+	engines := map[string]api.RiskEngine{
+		api.EngineASI1:   asi1Engine,
+		api.EngineAgent:  api.NewAgentEngine(getEnvOrDefault("RISK_AGENT_URL", api.DefaultAgentURL), newUpstream("risk advisor", upstreamTimeout)),
+		api.EngineNative: nativeEngine,
+	}
+
+	// Any OpenAI-compatible server (llama.cpp, vLLM, ...) is available as the
+	// llm engine once its base URL is configured
+	if llmBaseURL := os.Getenv("LLM_BASE_URL"); llmBaseURL != "" {
+		llmClient, err := api.NewOpenAIClient(api.LLMConfig{
+			BaseURL:    llmBaseURL,
+			Model:      os.Getenv("LLM_MODEL"),
+			APIKey:     os.Getenv("LLM_API_KEY"),
+			AuthHeader: os.Getenv("LLM_AUTH_HEADER"),
+			AuthScheme: os.Getenv("LLM_AUTH_SCHEME"),
+			ToolFormat: os.Getenv("LLM_TOOL_FORMAT"),
+			ToolChoice: os.Getenv("LLM_TOOL_CHOICE"),
+			HTTPClient: newUpstream("LLM", llmTimeout),
+		})
+		if err != nil {
+			log.Fatalf("Error initializing LLM client: %v", err)
+		}
+		llmMaxAttempts, err := strconv.Atoi(getEnvOrDefault("LLM_MAX_ATTEMPTS", "0"))
+		if err != nil {
+			log.Fatalf("Invalid LLM_MAX_ATTEMPTS: %v", err)
+		}
+		engines[api.EngineLLM] = api.NewLLMEngine(api.LLMEngineConfig{
+			Client:      llmClient,
+			MaxAttempts: llmMaxAttempts,
+			Fallback:    nativeEngine,
+			Prompts:     promptBuilder,
+		})
+	}
+
+	// Initialize the grounding guard for recommended tokens
+	registry, err := tokens.LoadRegistry(os.Getenv("TOKEN_REGISTRY_PATH"))
+	if err != nil {
+		log.Fatalf("Error loading token registry: %v", err)
+	}
+	guardMode := getEnvOrDefault("TOKEN_GUARD_MODE", "drop")
+	if guardMode != "drop" && guardMode != "flag" {
+		log.Fatalf("Invalid TOKEN_GUARD_MODE %q: expected drop or flag", guardMode)
+	}
+	// Network assumed for wallets with no holdings to ground against
+	guardNetwork := getEnvOrDefault("TOKEN_GUARD_NETWORK", tokens.DefaultNetwork)
+	if guardNetwork == "off" {
+		guardNetwork = ""
+	} else if _, ok := api.ChainBySlug(guardNetwork); !ok {
+		log.Fatalf("Invalid TOKEN_GUARD_NETWORK %q: expected a supported chain slug or off", guardNetwork)
+	}
+	guard := tokens.NewGuard(registry, guardMode == "drop", guardNetwork)
+
+	divergenceThreshold, err := strconv.ParseFloat(getEnvOrDefault("ENSEMBLE_DIVERGENCE_THRESHOLD", "0"), 64)
+	if err != nil {
+		log.Fatalf("Invalid ENSEMBLE_DIVERGENCE_THRESHOLD: %v", err)
+	}
+
+	// Initialize the snapshot store backing wallet history
+	var snapshotStore api.SnapshotStore
+	switch storeMode := getEnvOrDefault("SNAPSHOT_STORE", "file"); storeMode {
+	case "file":
+		store, err := snapshots.Open(os.Getenv("SNAPSHOT_DIR"))
+		if err != nil {
+			log.Fatalf("Error opening snapshot store: %v", err)
+		}
+		snapshotStore = store
+	case "off":
+	default:
+		log.Fatalf("Invalid SNAPSHOT_STORE %q: expected file or off", storeMode)
+	}
+
+	// Initialize ENS and Basenames resolution for /analyze and /positions
+	var nameResolver api.NameResolver
+	switch resolverMode := getEnvOrDefault("NAME_RESOLVER", "ens"); resolverMode {
+	case "ens":
+		nameResolver = ens.NewResolver(ens.Config{
+			ENSRPCURL:  os.Getenv("ENS_RPC_URL"),
+			BaseRPCURL: os.Getenv("BASE_RPC_URL"),
+			ENSClient:  newUpstream("ens", upstreamTimeout),
+			BaseClient: newUpstream("basenames", upstreamTimeout),
+		})
+	case "off":
+	default:
+		log.Fatalf("Invalid NAME_RESOLVER %q: expected ens or off", resolverMode)
+	}
+
+	batchConcurrency, err := strconv.Atoi(getEnvOrDefault("BATCH_CONCURRENCY", "0"))
+	if err != nil {
+		log.Fatalf("Invalid BATCH_CONCURRENCY: %v", err)
+	}
+	maxBatchSize, err := strconv.Atoi(getEnvOrDefault("BATCH_MAX_WALLETS", "0"))
+	if err != nil {
+		log.Fatalf("Invalid BATCH_MAX_WALLETS: %v", err)
+	}
+
+	cacheTTL, err := time.ParseDuration(getEnvOrDefault("PORTFOLIO_CACHE_TTL", api.DefaultCacheTTL.String()))
+	if err != nil {
+		log.Fatalf("Invalid PORTFOLIO_CACHE_TTL: %v", err)
+	}
+
 	// Initialize API server
-	server := api.NewServer()
+	server, err := api.NewServer(api.Config{
+		Portfolio:           portfolio,
+		Engines:             engines,
+		DefaultEngine:       *defaultEngine,
+		Factors:             nativeEngine,
+		Grounder:            guard,
+		Snapshots:           snapshotStore,
+		Resolver:            nameResolver,
+		Prompts:             promptBuilder,
+		CacheTTL:            cacheTTL,
+		DivergenceThreshold: divergenceThreshold,
+		BatchConcurrency:    batchConcurrency,
+		MaxBatchSize:        maxBatchSize,
+	})
+	if err != nil {
+		log.Fatalf("Error initializing server: %v", err)
+	}
 
 	// Set up Gin router
 	r := gin.Default()
@@ -39,7 +287,8 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Cache-Control, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Cache, Age, X-Request-ID, Retry-After")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(200)
 			return
@@ -47,6 +296,12 @@ func main() {
 		c.Next()
 	})
 
+	// Tag every request with an ID that error responses report
+	r.Use(func(c *gin.Context) {
+		api.RequestID(c.Writer, c.Request)
+		c.Next()
+	})
+
 	// Endpoints
 	r.GET("/positions", func(c *gin.Context) {
 		server.GetPositions(c.Writer, c.Request)
@@ -56,6 +311,30 @@ func main() {
 		server.AnalyzeWithASI(c.Writer, c.Request)
 	})
 
+	r.POST("/analyze", func(c *gin.Context) {
+		server.PostAnalyze(c.Writer, c.Request)
+	})
+
+	r.POST("/analyze/batch", func(c *gin.Context) {
+		server.PostAnalyzeBatch(c.Writer, c.Request)
+	})
+
+	r.GET("/wallets/:address/history", func(c *gin.Context) {
+		c.Request.SetPathValue("address", c.Param("address"))
+		server.GetHistory(c.Writer, c.Request)
+	})
+
+	r.GET("/wallets/:address/diff", func(c *gin.Context) {
+		c.Request.SetPathValue("address", c.Param("address"))
+		server.GetDiff(c.Writer, c.Request)
+	})
+
+	r.GET("/wallets/:address/snapshots/:id", func(c *gin.Context) {
+		c.Request.SetPathValue("address", c.Param("address"))
+		c.Request.SetPathValue("id", c.Param("id"))
+		server.GetSnapshot(c.Writer, c.Request)
+	})
+
 	// Start server
 	address := fmt.Sprintf(":%s", *port)
 	log.Printf("Starting server on %s", address)
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"dex-analyzer/internal/rpcfake"
+)
+
+func main() {
+	port := flag.String("port", "8545", "Port to run the fake JSON-RPC server on")
+	namesPath := flag.String("names", "fixtures/ens/names.json", "JSON file mapping ENS names and Basenames to addresses")
+	flag.Parse()
+
+	names, err := rpcfake.LoadNames(*namesPath)
+	if err != nil {
+		log.Fatalf("Error loading names: %v", err)
+	}
+
+	address := fmt.Sprintf(":%s", *port)
+	log.Printf("Fake JSON-RPC listening on %s with %d names, set ENS_RPC_URL and BASE_RPC_URL to http://localhost%s", address, len(names), address)
+	if err := http.ListenAndServe(address, rpcfake.NewServer(names)); err != nil {
+		log.Fatalf("Error starting fake JSON-RPC server: %v", err)
+	}
+}
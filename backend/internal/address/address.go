@@ -0,0 +1,79 @@
+// Package address validates and normalizes Ethereum addresses. Lowercase hex
+// is the canonical form used for cache keys, snapshot storage and upstream
+// requests; EIP-55 mixed case is only accepted when its checksum is correct.
+package address
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// hexLength is the number of hex digits of an address after the 0x prefix
+const hexLength = 40
+
+// Validation errors; Parse wraps them with the details of the input
+var (
+	ErrEmpty         = errors.New("address is empty")
+	ErrMissingPrefix = errors.New("address must start with 0x")
+	ErrLength        = errors.New("address must have 40 hex digits after 0x")
+	ErrInvalidHex    = errors.New("address contains a non-hex character")
+	ErrChecksum      = errors.New("address has an invalid EIP-55 checksum")
+)
+
+// Parse validates s and returns its canonical lowercase form. All-lowercase
+// and all-uppercase hex is accepted as is; mixed case must be a valid EIP-55
+// checksum.
+func Parse(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", ErrEmpty
+	}
+	if !strings.HasPrefix(s, "0x") {
+		return "", fmt.Errorf("%w, got %q", ErrMissingPrefix, s)
+	}
+
+	digits := s[2:]
+	if len(digits) != hexLength {
+		return "", fmt.Errorf("%w, got %d", ErrLength, len(digits))
+	}
+	for i, c := range digits {
+		if !isHex(c) {
+			return "", fmt.Errorf("%w: %q at position %d", ErrInvalidHex, c, i+2)
+		}
+	}
+
+	lower := strings.ToLower(digits)
+	canonical := "0x" + lower
+	if digits != lower && digits != strings.ToUpper(digits) {
+		if checksummed := Checksum(canonical); checksummed != s {
+			return "", fmt.Errorf("%w, expected %s", ErrChecksum, checksummed)
+		}
+	}
+	return canonical, nil
+}
+
+// Checksum returns the EIP-55 mixed-case form of a valid address
+func Checksum(address string) string {
+	digits := strings.ToLower(strings.TrimPrefix(address, "0x"))
+
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(digits))
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	out := []byte(digits)
+	for i, c := range out {
+		// Letters are uppercased where the matching hash nibble is 8 or more
+		if c >= 'a' && c <= 'f' && sum[i] >= '8' {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out)
+}
+
+func isHex(c rune) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,66 @@
+package address
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// eip55Vectors are the test cases of the EIP-55 specification
+var eip55Vectors = []string{
+	// All caps
+	"0x52908400098527886E0F7030069857D2E4169EE7",
+	"0x8617E340B3D01FA5F11F306F4090FD50E238070D",
+	// All lower
+	"0xde709f2102306220921060314715629080e2fb77",
+	"0x27b1fdb04752bbc536007a920d24acb045561c26",
+	// Normal
+	"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+	"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+	"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+	"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+}
+
+func TestChecksum(t *testing.T) {
+	for _, vector := range eip55Vectors {
+		if got := Checksum(strings.ToLower(vector)); got != vector {
+			t.Errorf("Checksum(%s) = %s, want %s", strings.ToLower(vector), got, vector)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, vector := range eip55Vectors {
+		got, err := Parse(vector)
+		if err != nil || got != strings.ToLower(vector) {
+			t.Errorf("Parse(%s) = %s, %v; want %s", vector, got, err, strings.ToLower(vector))
+		}
+	}
+
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{in: "  0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed ", want: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"},
+		{in: "0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", want: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"},
+		{in: "", err: ErrEmpty},
+		{in: "5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", err: ErrMissingPrefix},
+		{in: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeA", err: ErrLength},
+		{in: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed00", err: ErrLength},
+		{in: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeZ", err: ErrInvalidHex},
+		{in: "0x5aaeb6053F3E94C9b9A09f33669435E7Ef1BeAed", err: ErrChecksum},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %s, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"dex-analyzer/internal/upstream"
+)
+
+// DefaultAgentURL is the REST endpoint exposed by agents/risk_advisor.py
+const DefaultAgentURL = "http://localhost:8000/api/analyze"
+
+// AgentEngine is a RiskEngine backed by the Python MeTTa risk advisor agent
+type AgentEngine struct {
+	url    string
+	client *upstream.Client
+}
+
+// NewAgentEngine creates a risk engine that posts requests to the agent at
+// url. A client with the upstream defaults is used when client is nil.
+func NewAgentEngine(url string, client *upstream.Client) *AgentEngine {
+	if client == nil {
+		client = upstream.NewClient(upstream.Config{Name: "risk advisor"})
+	}
+	return &AgentEngine{
+		url:    url,
+		client: client,
+	}
+}
+
+// Analyze calls the risk advisor API with the given risk request
+func (e *AgentEngine) Analyze(ctx context.Context, riskRequest RiskRequest) (*RiskResponse, error) {
+	// Marshal the risk request to JSON
+	requestBody, err := json.Marshal(riskRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal risk request: %w", err)
+	}
+
+	// Create HTTP request to the risk advisor API
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+
+	// Make HTTP request; non-2xx responses are errors after any retries
+	body, err := e.client.Do(req)
+	if err != nil {
+		return nil, &UpstreamError{Upstream: "agent", Kind: ErrUpstreamAgent, Err: err}
+	}
+
+	// Parse response
+	var riskResponse RiskResponse
+	if err := json.Unmarshal(body, &riskResponse); err != nil {
+		return nil, &UpstreamError{Upstream: "agent", Kind: ErrUpstreamAgent, Err: fmt.Errorf("failed to unmarshal risk response: %w", err)}
+	}
+
+	return &riskResponse, nil
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxAnalyzeBody caps the size of POST /analyze bodies
+const maxAnalyzeBody = 1 << 20
+
+// StringList is a list option that decodes from a JSON array of strings or
+// numbers, or from a single comma separated string as used in query
+// parameters
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*l = StringList{text}
+		return nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("expected a string or a list, got %s", data)
+	}
+	list := make(StringList, 0, len(items))
+	for _, item := range items {
+		var value string
+		if err := json.Unmarshal(item, &value); err == nil {
+			list = append(list, value)
+			continue
+		}
+		var number json.Number
+		if err := json.Unmarshal(item, &number); err != nil {
+			return fmt.Errorf("list items must be strings or numbers, got %s", item)
+		}
+		list = append(list, number.String())
+	}
+	*l = list
+	return nil
+}
+
+// String joins the list in query parameter syntax
+func (l StringList) String() string {
+	return strings.Join(l, ",")
+}
+
+// analyzeRequestFromQuery reads the GET /analyze query parameters
+func analyzeRequestFromQuery(query url.Values) (AnalyzeRequest, error) {
+	req := AnalyzeRequest{
+		Address: query.Get("address"),
+		AnalysisOptions: AnalysisOptions{
+			RiskProfile:   query.Get("risk_profile"),
+			PromptVersion: query.Get("prompt"),
+		},
+	}
+	if value := query.Get("engine"); value != "" {
+		req.Engine = StringList{value}
+	}
+	if value := query.Get("chains"); value != "" {
+		req.Chains = StringList{value}
+	}
+	if value := query.Get("min_usd"); value != "" {
+		minUSD, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return req, fmt.Errorf("%w: min_usd must be a number", ErrInvalidRequest)
+		}
+		req.MinUSD = minUSD
+	}
+	for name, flag := range map[string]**bool{
+		"include_token_balances": &req.IncludeTokenBalances,
+		"include_app_balances":   &req.IncludeAppBalances,
+	} {
+		if value := query.Get(name); value != "" {
+			include, err := strconv.ParseBool(value)
+			if err != nil {
+				return req, fmt.Errorf("%w: %s must be true or false", ErrInvalidRequest, name)
+			}
+			*flag = &include
+		}
+	}
+	return req, nil
+}
+
+// PostAnalyze handles POST /analyze with an AnalyzeRequest body
+func (s *Server) PostAnalyze(w http.ResponseWriter, r *http.Request) {
+	var req AnalyzeRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnalyzeBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, r, fmt.Errorf("%w: invalid JSON body: %v", ErrInvalidRequest, err))
+		return
+	}
+	s.analyzeWallet(w, r, req)
+}
+
+// analysisPlan is a validated set of AnalysisOptions
+type analysisPlan struct {
+	engines  []string
+	chainIDs []int
+	options  AnalysisOptions
+}
+
+// scope is the snapshot scope of analyses run with the plan
+func (p analysisPlan) scope() SnapshotScope {
+	return SnapshotScope{Chains: p.chainIDs, MinUSD: p.options.MinUSD}
+}
+
+// planAnalysis validates the options of a request. Addresses are checked
+// separately since names need a network round trip.
+func (s *Server) planAnalysis(req AnalysisOptions) (analysisPlan, error) {
+	// Several engines request an ensemble analysis
+	engines := parseEngineNames(req.Engine.String())
+	for _, name := range engines {
+		if _, _, err := s.engine(name); err != nil {
+			return analysisPlan{}, invalidRequest(err)
+		}
+	}
+
+	chainIDs, err := ParseChains(req.Chains.String())
+	if err != nil {
+		return analysisPlan{}, invalidRequest(err)
+	}
+
+	if req.MinUSD < 0 {
+		return analysisPlan{}, fmt.Errorf("%w: min_usd must not be negative", ErrInvalidRequest)
+	}
+
+	if s.prompts != nil {
+		if err := s.prompts.Validate(req.RiskProfile, req.PromptVersion); err != nil {
+			return analysisPlan{}, err
+		}
+	}
+
+	return analysisPlan{engines: engines, chainIDs: chainIDs, options: req}, nil
+}
+
+// analyzeWallet is the shared body of GET and POST /analyze
+func (s *Server) analyzeWallet(w http.ResponseWriter, r *http.Request, req AnalyzeRequest) {
+	plan, err := s.planAnalysis(req.AnalysisOptions)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	address, name, err := s.resolveWallet(r.Context(), req.Address)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	riskRequest, err := s.fetchPortfolio(w, r, address, plan.chainIDs)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	portfolio := preparePortfolio(*riskRequest, plan)
+	riskResponse, err := s.scorePortfolio(r.Context(), portfolio, name, plan)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.saveSnapshot(portfolio, riskResponse, plan.scope())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(riskResponse)
+}
+
+// preparePortfolio applies the request's prompt options and dust threshold
+// to a fetched portfolio
+func preparePortfolio(riskRequest RiskRequest, plan analysisPlan) RiskRequest {
+	riskRequest.RiskProfile = plan.options.RiskProfile
+	riskRequest.PromptVersion = plan.options.PromptVersion
+	if plan.options.MinUSD > 0 {
+		riskRequest = withoutDust(riskRequest, plan.options.MinUSD)
+	}
+	return riskRequest
+}
+
+// scorePortfolio analyzes a prepared portfolio with the request's engines and
+// attaches the chain subtotals and, unless opted out, the balances
+func (s *Server) scorePortfolio(ctx context.Context, riskRequest RiskRequest, name string, plan analysisPlan) (*RiskResponse, error) {
+	riskResponse, err := s.analyze(ctx, plan.engines, riskRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	riskResponse.Address = riskRequest.Address
+	riskResponse.Name = name
+	riskResponse.Chains = chainSubtotals(riskRequest)
+	riskResponse.Truncated = riskRequest.TokenBalances.Truncated || riskRequest.AppBalances.Truncated
+	if plan.options.IncludeTokenBalances == nil || *plan.options.IncludeTokenBalances {
+		riskResponse.TokenBalances = &riskRequest.TokenBalances
+	}
+	if plan.options.IncludeAppBalances == nil || *plan.options.IncludeAppBalances {
+		riskResponse.AppBalances = &riskRequest.AppBalances
+	}
+	return riskResponse, nil
+}
+
+// withoutDust drops wallet tokens and app positions worth less than minUSD.
+// Totals and counts are reduced by what was dropped. The portfolio may be
+// shared with the cache, so filtered slices are copies.
+func withoutDust(req RiskRequest, minUSD float64) RiskRequest {
+	tokens := make([]TokenBalance, 0, len(req.TokenBalances.ByToken))
+	for _, token := range req.TokenBalances.ByToken {
+		if token.BalanceUSD < minUSD {
+			req.TokenBalances.TotalBalanceUSD -= token.BalanceUSD
+			req.TokenBalances.TotalCount--
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	req.TokenBalances.ByToken = tokens
+
+	apps := make([]AppBalance, 0, len(req.AppBalances.ByApp))
+	for _, appBalance := range req.AppBalances.ByApp {
+		positions := make([]ContractPosition, 0, len(appBalance.Balances))
+		for _, position := range appBalance.Balances {
+			// Debt positions carry negative values and are never dust
+			if position.BalanceUSD >= 0 && position.BalanceUSD < minUSD {
+				req.AppBalances.TotalBalanceUSD -= position.BalanceUSD
+				continue
+			}
+			positions = append(positions, position)
+		}
+		if len(positions) == 0 {
+			req.AppBalances.TotalCount--
+			continue
+		}
+		appBalance.Balances = positions
+		apps = append(apps, appBalance)
+	}
+	req.AppBalances.ByApp = apps
+
+	if req.TokenBalances.TotalCount < 0 {
+		req.TokenBalances.TotalCount = 0
+	}
+	if req.AppBalances.TotalCount < 0 {
+		req.AppBalances.TotalCount = 0
+	}
+	return req
+}
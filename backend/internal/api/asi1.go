@@ -0,0 +1,66 @@
+package api
+
+import "dex-analyzer/internal/upstream"
+
+// DefaultASI1BaseURL is the ASI:One OpenAI-compatible API
+const DefaultASI1BaseURL = "https://api.asi1.ai/v1"
+
+// DefaultASI1Model is the ASI:One model used for analysis
+const DefaultASI1Model = "asi1-mini"
+
+// DefaultASI1MaxAttempts bounds how often ASI1 is prompted for valid tool output
+const DefaultASI1MaxAttempts = DefaultLLMMaxAttempts
+
+// ASI1Config configures the ASI:One risk engine
+type ASI1Config struct {
+	APIKey string
+	// BaseURL is the OpenAI-compatible API root that /chat/completions is
+	// appended to; DefaultASI1BaseURL is used when empty
+	BaseURL string
+	// Model defaults to DefaultASI1Model
+	Model string
+	// MaxAttempts is the number of prompts, including re-prompts after invalid
+	// tool output; DefaultASI1MaxAttempts is used when zero
+	MaxAttempts int
+	// Fallback, when set, scores the portfolio after every attempt fails
+	// validation
+	Fallback RiskEngine
+	// Prompts renders the opening messages; see LLMEngineConfig
+	Prompts PromptBuilder
+	// HTTPClient sends the requests; see LLMConfig
+	HTTPClient *upstream.Client
+}
+
+// NewASI1Engine creates an ASI:One backed risk engine
+func NewASI1Engine(cfg ASI1Config) (*LLMEngine, error) {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultASI1BaseURL
+	}
+
+	model := cfg.Model
+	if model == "" {
+		model = DefaultASI1Model
+	}
+
+	client, err := NewOpenAIClient(LLMConfig{
+		Name:          "ASI1",
+		BaseURL:       baseURL,
+		Model:         model,
+		APIKey:        cfg.APIKey,
+		RequireAPIKey: true,
+		SessionHeader: "x-session-id",
+		HTTPClient:    cfg.HTTPClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLLMEngine(LLMEngineConfig{
+		Name:        "ASI1",
+		Client:      client,
+		MaxAttempts: cfg.MaxAttempts,
+		Fallback:    cfg.Fallback,
+		Prompts:     cfg.Prompts,
+	}), nil
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dex-analyzer/internal/asi1fake"
+	"dex-analyzer/internal/upstream"
+)
+
+const fakeASI1Key = "test-key"
+
+// newASI1Server serves GET /analyze with the ASI1 engine talking to the fake
+// ASI:One server scripted with script
+func newASI1Server(t *testing.T, apiKey string, fallback RiskEngine, script ...asi1fake.Reply) (*Server, *asi1fake.Server) {
+	t.Helper()
+	fake := asi1fake.NewServer(fakeASI1Key, script...)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	engine, err := NewASI1Engine(ASI1Config{
+		APIKey:   apiKey,
+		BaseURL:  srv.URL + "/v1",
+		Fallback: fallback,
+		HTTPClient: upstream.NewClient(upstream.Config{
+			Name:      "ASI1",
+			BaseDelay: time.Millisecond,
+			MaxDelay:  5 * time.Millisecond,
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewASI1Engine: %v", err)
+	}
+
+	server, err := NewServer(Config{
+		Portfolio:     emptyProvider{},
+		Engines:       map[string]RiskEngine{EngineASI1: engine},
+		DefaultEngine: EngineASI1,
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return server, fake
+}
+
+func TestAnalyzeWithASI(t *testing.T) {
+	malformed := asi1fake.MalformedToolCall(`{"recommended_tokens": ["USDC"], "risk_score": `)
+	noToolCall := asi1fake.NoToolCall("Your portfolio looks fine.")
+	serverError := asi1fake.Error(http.StatusInternalServerError, `{"error": "overloaded"}`)
+	native := fixedEngine{RiskResponse{RiskScore: 0.15, Reasoning: []string{"native"}}}
+
+	tests := []struct {
+		name     string
+		apiKey   string
+		fallback RiskEngine
+		script   []asi1fake.Reply
+		status   int
+		code     string
+		path     string
+		requests int
+	}{
+		{name: "valid", script: []asi1fake.Reply{asi1fake.Valid}, status: http.StatusOK, path: PathToolCall, requests: 1},
+		{name: "retried after malformed arguments", script: []asi1fake.Reply{malformed, asi1fake.Valid}, status: http.StatusOK, path: PathToolCallRetry, requests: 2},
+		{name: "retried after no tool call", script: []asi1fake.Reply{noToolCall, noToolCall, asi1fake.Valid}, status: http.StatusOK, path: PathToolCallRetry, requests: 3},
+		{name: "malformed arguments", script: []asi1fake.Reply{malformed}, status: http.StatusBadGateway, code: CodeUpstreamLLM, requests: 3},
+		{name: "no tool call", script: []asi1fake.Reply{noToolCall}, status: http.StatusBadGateway, code: CodeLLMNoToolCall, requests: 3},
+		{name: "fallback", fallback: native, script: []asi1fake.Reply{malformed, noToolCall}, status: http.StatusOK, path: PathFallback, requests: 3},
+		{name: "server error retried", script: []asi1fake.Reply{serverError, asi1fake.Valid}, status: http.StatusOK, path: PathToolCall, requests: 2},
+		{name: "server error", script: []asi1fake.Reply{serverError}, status: http.StatusBadGateway, code: CodeUpstreamLLM, requests: upstream.DefaultMaxAttempts},
+		{name: "rate limited", script: []asi1fake.Reply{asi1fake.Error(http.StatusTooManyRequests, "slow down")}, status: http.StatusServiceUnavailable, code: CodeUpstreamRateLimited, requests: upstream.DefaultMaxAttempts},
+		{name: "wrong API key", apiKey: "other-key", script: []asi1fake.Reply{asi1fake.Valid}, status: http.StatusBadGateway, code: CodeUpstreamLLM, requests: 0},
+	}
+	for _, tt := range tests {
+		apiKey := tt.apiKey
+		if apiKey == "" {
+			apiKey = fakeASI1Key
+		}
+		server, fake := newASI1Server(t, apiKey, tt.fallback, tt.script...)
+
+		rec := httptest.NewRecorder()
+		server.AnalyzeWithASI(rec, httptest.NewRequest(http.MethodGet, "/analyze?address="+sampleWallet, nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		if got := len(fake.Requests()); got != tt.requests {
+			t.Errorf("%s: fake received %d requests, want %d", tt.name, got, tt.requests)
+		}
+
+		if tt.code != "" {
+			var resp ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("%s: decode error: %v", tt.name, err)
+			}
+			if resp.Code != tt.code || resp.Upstream != "asi1" {
+				t.Errorf("%s: error %q from %q, want %q from asi1", tt.name, resp.Code, resp.Upstream, tt.code)
+			}
+			continue
+		}
+
+		var resp RiskResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode analysis: %v", tt.name, err)
+		}
+		if resp.Path != tt.path || resp.Address != sampleWallet {
+			t.Errorf("%s: path %q for %s, want %q for %s", tt.name, resp.Path, resp.Address, tt.path, sampleWallet)
+		}
+	}
+}
+
+func TestAnalyzeWithASISampleScripts(t *testing.T) {
+	tests := []struct {
+		script string
+		status int
+		path   string
+	}{
+		{script: "retry.json", status: http.StatusOK, path: PathToolCallRetry},
+		{script: "unavailable.json", status: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		script, err := asi1fake.LoadScript(filepath.Join("..", "..", "fixtures", "asi1", tt.script))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.script, err)
+		}
+		server, _ := newASI1Server(t, fakeASI1Key, nil, script...)
+
+		rec := httptest.NewRecorder()
+		server.AnalyzeWithASI(rec, httptest.NewRequest(http.MethodGet, "/analyze?address="+sampleWallet, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.script, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		if tt.path == "" {
+			continue
+		}
+		var resp RiskResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode analysis: %v", tt.script, err)
+		}
+		if resp.Path != tt.path || resp.Attempts != 3 {
+			t.Errorf("%s: path %q after %d attempts, want %q after 3", tt.script, resp.Path, resp.Attempts, tt.path)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultBatchConcurrency is how many wallets of a batch are analyzed at once
+const DefaultBatchConcurrency = 4
+
+// DefaultMaxBatchSize is the largest number of addresses accepted in a batch
+const DefaultMaxBatchSize = 25
+
+// BatchAnalyzeRequest is the body of POST /analyze/batch. Every wallet is
+// analyzed with the same options.
+type BatchAnalyzeRequest struct {
+	// Addresses are 0x addresses, ENS names or Basenames
+	Addresses []string `json:"addresses"`
+	AnalysisOptions
+}
+
+// WalletResult is the analysis of one wallet of a batch
+type WalletResult struct {
+	// Input is the address or name as sent in the request
+	Input   string `json:"input"`
+	Address string `json:"address,omitempty"`
+	Name    string `json:"name,omitempty"`
+	// Cache is the portfolio cache status, as in the X-Cache header
+	Cache    string        `json:"cache,omitempty"`
+	Analysis *RiskResponse `json:"analysis,omitempty"`
+	// Error and ErrorCode describe a failed wallet like an ErrorResponse
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// HouseholdResult scores the combined portfolio of the wallets of a batch
+type HouseholdResult struct {
+	// Addresses are the distinct wallets merged into the household
+	Addresses []string      `json:"addresses"`
+	Analysis  *RiskResponse `json:"analysis,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	ErrorCode string        `json:"error_code,omitempty"`
+}
+
+// BatchAnalyzeResponse is the body returned by POST /analyze/batch. Wallets
+// are in request order.
+type BatchAnalyzeResponse struct {
+	Wallets   []WalletResult   `json:"wallets"`
+	Household *HouseholdResult `json:"household,omitempty"`
+}
+
+// PostAnalyzeBatch handles POST /analyze/batch. Wallets are analyzed
+// concurrently and failures are reported per wallet; the request only fails
+// when every wallet does.
+func (s *Server) PostAnalyzeBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchAnalyzeRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnalyzeBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, r, fmt.Errorf("%w: invalid JSON body: %v", ErrInvalidRequest, err))
+		return
+	}
+
+	if len(req.Addresses) == 0 {
+		writeError(w, r, fmt.Errorf("%w: addresses is required", ErrInvalidRequest))
+		return
+	}
+	if len(req.Addresses) > s.maxBatchSize {
+		writeError(w, r, fmt.Errorf("%w: at most %d addresses are allowed per batch, got %d", ErrInvalidRequest, s.maxBatchSize, len(req.Addresses)))
+		return
+	}
+
+	// Options are shared, so they are validated once for the whole batch
+	plan, err := s.planAnalysis(req.AnalysisOptions)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	wallets, portfolios, errs := s.analyzeWallets(r.Context(), req, plan, wantsFresh(r))
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == len(wallets) {
+		writeError(w, r, fmt.Errorf("every wallet in the batch failed: %w", errors.Join(failed...)))
+		return
+	}
+
+	response := BatchAnalyzeResponse{
+		Wallets:   wallets,
+		Household: s.analyzeHousehold(r.Context(), portfolios, plan),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// analyzeWallets analyzes the wallets of a batch with at most
+// batchConcurrency in flight. It returns the results in request order along
+// with the prepared portfolios of the wallets that succeeded.
+func (s *Server) analyzeWallets(ctx context.Context, req BatchAnalyzeRequest, plan analysisPlan, fresh bool) ([]WalletResult, []RiskRequest, []error) {
+	results := make([]WalletResult, len(req.Addresses))
+	portfolios := make([]*RiskRequest, len(req.Addresses))
+	errs := make([]error, len(req.Addresses))
+
+	sem := make(chan struct{}, s.batchConcurrency)
+	var wg sync.WaitGroup
+	for i, input := range req.Addresses {
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result := WalletResult{Input: input}
+			portfolio, err := s.analyzeBatchWallet(ctx, input, plan, fresh, &result)
+			if err != nil {
+				result.Error, result.ErrorCode = partialError("Batch wallet "+input, err)
+				errs[i] = fmt.Errorf("wallet %s failed: %w", input, err)
+			}
+			results[i] = result
+			portfolios[i] = portfolio
+		}(i, input)
+	}
+	wg.Wait()
+
+	prepared := make([]RiskRequest, 0, len(portfolios))
+	for _, portfolio := range portfolios {
+		if portfolio != nil {
+			prepared = append(prepared, *portfolio)
+		}
+	}
+	return results, prepared, errs
+}
+
+// analyzeBatchWallet resolves, fetches and scores one wallet of a batch,
+// filling in result as it goes, and returns the prepared portfolio
+func (s *Server) analyzeBatchWallet(ctx context.Context, input string, plan analysisPlan, fresh bool, result *WalletResult) (*RiskRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	address, name, err := s.resolveWallet(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	result.Address, result.Name = address, name
+
+	riskRequest, status, _, err := s.loadPortfolio(ctx, address, plan.chainIDs, fresh)
+	result.Cache = status
+	if err != nil {
+		return nil, err
+	}
+
+	portfolio := preparePortfolio(*riskRequest, plan)
+	analysis, err := s.scorePortfolio(ctx, portfolio, name, plan)
+	if err != nil {
+		return nil, err
+	}
+	s.saveSnapshot(portfolio, analysis, plan.scope())
+	result.Analysis = analysis
+	return &portfolio, nil
+}
+
+// analyzeHousehold scores the merged portfolios of a batch. A wallet listed
+// more than once, for example by address and by name, is counted once. No
+// snapshot is stored since the household is not a wallet.
+func (s *Server) analyzeHousehold(ctx context.Context, portfolios []RiskRequest, plan analysisPlan) *HouseholdResult {
+	if len(portfolios) == 0 {
+		return nil
+	}
+
+	household, addresses := mergePortfolios(portfolios)
+	result := &HouseholdResult{Addresses: addresses}
+
+	analysis, err := s.scorePortfolio(ctx, household, "", plan)
+	if err != nil {
+		result.Error, result.ErrorCode = partialError("Household analysis of "+household.Address, err)
+		return result
+	}
+	// The merged address list is only a label for the engines
+	analysis.Address = ""
+	result.Analysis = analysis
+	return result
+}
+
+// mergePortfolios combines wallet portfolios into one so that exposure to the
+// same token across wallets is scored as a single holding. Wallet tokens are
+// summed per chain and contract; app positions are grouped per app and chain,
+// and counts no longer include the holdings merged away. The merged
+// portfolio's address lists the distinct wallets.
+func mergePortfolios(portfolios []RiskRequest) (RiskRequest, []string) {
+	merged := RiskRequest{
+		TokenBalances: TokenBalances{ByToken: make([]TokenBalance, 0)},
+		AppBalances:   AppBalances{ByApp: make([]AppBalance, 0)},
+	}
+	addresses := make([]string, 0, len(portfolios))
+	seen := make(map[string]bool)
+	tokens := make(map[string]int)
+	apps := make(map[string]int)
+
+	for _, portfolio := range portfolios {
+		if seen[portfolio.Address] {
+			continue
+		}
+		seen[portfolio.Address] = true
+		addresses = append(addresses, portfolio.Address)
+
+		// Prompt options are the same for every wallet of a batch
+		merged.RiskProfile = portfolio.RiskProfile
+		merged.PromptVersion = portfolio.PromptVersion
+		merged.TokenBalances.TotalBalanceUSD += portfolio.TokenBalances.TotalBalanceUSD
+		merged.TokenBalances.TotalCount += portfolio.TokenBalances.TotalCount
+		merged.TokenBalances.Truncated = merged.TokenBalances.Truncated || portfolio.TokenBalances.Truncated
+		merged.AppBalances.TotalBalanceUSD += portfolio.AppBalances.TotalBalanceUSD
+		merged.AppBalances.TotalCount += portfolio.AppBalances.TotalCount
+		merged.AppBalances.Truncated = merged.AppBalances.Truncated || portfolio.AppBalances.Truncated
+
+		for _, token := range portfolio.TokenBalances.ByToken {
+			key := tokenKey(token)
+			i, ok := tokens[key]
+			if !ok {
+				tokens[key] = len(merged.TokenBalances.ByToken)
+				merged.TokenBalances.ByToken = append(merged.TokenBalances.ByToken, token)
+				continue
+			}
+			merged.TokenBalances.TotalCount--
+			total := &merged.TokenBalances.ByToken[i]
+			total.Balance += token.Balance
+			total.BalanceUSD += token.BalanceUSD
+			total.BalanceRaw = sumRaw(total.BalanceRaw, token.BalanceRaw, total.Balance, int(total.Decimals))
+		}
+
+		for _, appBalance := range portfolio.AppBalances.ByApp {
+			key := appBalance.Network.Slug + ":" + appBalance.App.Slug
+			i, ok := apps[key]
+			if !ok {
+				apps[key] = len(merged.AppBalances.ByApp)
+				// Copy the positions so the cached portfolio is never appended to
+				appBalance.Balances = append([]ContractPosition(nil), appBalance.Balances...)
+				merged.AppBalances.ByApp = append(merged.AppBalances.ByApp, appBalance)
+				continue
+			}
+			merged.AppBalances.TotalCount--
+			total := &merged.AppBalances.ByApp[i]
+			total.Balances = append(total.Balances, appBalance.Balances...)
+		}
+	}
+
+	merged.Address = strings.Join(addresses, ", ")
+	return merged, addresses
+}
+
+// sumRaw adds two base-unit amounts, falling back to converting the summed
+// decimal balance when either is not an integer
+func sumRaw(a, b string, balance float64, decimals int) string {
+	x, okA := new(big.Int).SetString(a, 10)
+	y, okB := new(big.Int).SetString(b, 10)
+	if !okA || !okB {
+		return rawAmount(balance, decimals)
+	}
+	return x.Add(x, y).String()
+}
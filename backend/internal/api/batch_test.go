@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMergePortfoliosKeepsAppsOfOneCategoryApart(t *testing.T) {
+	base := Network{Name: "Base", Slug: "base", ChainID: 8453}
+	wallet := func(address string, apps ...AppBalance) RiskRequest {
+		return RiskRequest{Address: address, AppBalances: AppBalances{TotalCount: len(apps), ByApp: apps}}
+	}
+	aave := App{DisplayName: "Aave V3", Slug: "aave-v3"}
+	morpho := App{DisplayName: "Morpho", Slug: "morpho"}
+
+	merged, addresses := mergePortfolios([]RiskRequest{
+		wallet("0xa", AppBalance{App: aave, Network: base, Balances: []ContractPosition{{Address: "a1", BalanceUSD: 10}}}),
+		wallet("0xb",
+			AppBalance{App: morpho, Network: base, Balances: []ContractPosition{{Address: "m1", BalanceUSD: 20}}},
+			AppBalance{App: aave, Network: base, Balances: []ContractPosition{{Address: "a2", BalanceUSD: 30}}},
+		),
+	})
+
+	if len(addresses) != 2 {
+		t.Errorf("addresses = %v, want both wallets", addresses)
+	}
+	if merged.AppBalances.TotalCount != 2 || len(merged.AppBalances.ByApp) != 2 {
+		t.Fatalf("merged %d apps (count %d), want Aave V3 and Morpho", len(merged.AppBalances.ByApp), merged.AppBalances.TotalCount)
+	}
+	for i, want := range []struct {
+		app       App
+		positions int
+	}{{aave, 2}, {morpho, 1}} {
+		got := merged.AppBalances.ByApp[i]
+		if got.App != want.app || len(got.Balances) != want.positions {
+			t.Errorf("app %d = %+v with %d positions, want %+v with %d", i, got.App, len(got.Balances), want.app, want.positions)
+		}
+	}
+}
+
+func TestBatchAnalyzeRequestDecodesSharedOptions(t *testing.T) {
+	body := `{"addresses": ["a.eth"], "engine": ["asi1", "native"], "chains": "base,1", "risk_profile": "conservative",
+		"prompt": "v2", "min_usd": 5, "include_app_balances": false}`
+	var req BatchAnalyzeRequest
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	opts := req.AnalysisOptions
+	if opts.Engine.String() != "asi1,native" || opts.Chains.String() != "base,1" || opts.RiskProfile != "conservative" ||
+		opts.PromptVersion != "v2" || opts.MinUSD != 5 || opts.IncludeTokenBalances != nil ||
+		opts.IncludeAppBalances == nil || *opts.IncludeAppBalances {
+		t.Errorf("options = %+v, want every option of the body", opts)
+	}
+
+	decoder = json.NewDecoder(strings.NewReader(`{"addresses": ["a.eth"], "address": "b.eth"}`))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&BatchAnalyzeRequest{}); err == nil {
+		t.Error("a single address was accepted in a batch body")
+	}
+}
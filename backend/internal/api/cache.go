@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long fetched portfolios are served from memory
+const DefaultCacheTTL = time.Minute
+
+// Values of the X-Cache response header
+const (
+	// CacheHit means the portfolio was served from the cache
+	CacheHit = "HIT"
+	// CacheMiss means this request fetched the portfolio
+	CacheMiss = "MISS"
+	// CacheCoalesced means the request waited for an identical in-flight fetch
+	CacheCoalesced = "COALESCED"
+	// CacheBypass means the request asked for fresh data and fetched it
+	// without joining any in-flight fetch
+	CacheBypass = "BYPASS"
+)
+
+// portfolioCache is a TTL cache in front of a PortfolioProvider. Concurrent
+// misses for the same key share a single upstream fetch.
+type portfolioCache struct {
+	provider PortfolioProvider
+	ttl      time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]cacheEntry
+	inflight map[string]*portfolioCall
+}
+
+type cacheEntry struct {
+	req       *RiskRequest
+	fetchedAt time.Time
+}
+
+// portfolioCall is an upstream fetch that other requests can wait on
+type portfolioCall struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	// waiters counts the callers still waiting on done; guarded by the
+	// cache mutex
+	waiters int
+
+	req       *RiskRequest
+	fetchedAt time.Time
+	err       error
+}
+
+func newPortfolioCache(provider PortfolioProvider, ttl time.Duration) *portfolioCache {
+	return &portfolioCache{
+		provider: provider,
+		ttl:      ttl,
+		entries:  make(map[string]cacheEntry),
+		inflight: make(map[string]*portfolioCall),
+	}
+}
+
+// cacheKey identifies a portfolio by address and chain scope. chainIDs are
+// sorted and deduplicated by ParseChains.
+func cacheKey(address string, chainIDs []int) string {
+	ids := make([]string, len(chainIDs))
+	for i, id := range chainIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return strings.ToLower(address) + "|" + strings.Join(ids, ",")
+}
+
+// fetch returns a copy of the portfolio, the X-Cache status and when the
+// portfolio was fetched. fresh skips both cached entries and in-flight
+// fetches but still refreshes the cache.
+//
+// The upstream fetch runs detached from any single request so that callers
+// coalesced onto it are not failed by the first caller disconnecting. It is
+// cancelled once every waiting caller's context is done.
+func (c *portfolioCache) fetch(ctx context.Context, address string, chainIDs []int, fresh bool) (*RiskRequest, string, time.Time, error) {
+	key := cacheKey(address, chainIDs)
+	if fresh {
+		return c.fetchFresh(ctx, key, address, chainIDs)
+	}
+	status := CacheMiss
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && time.Since(entry.fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		req := *entry.req
+		return &req, CacheHit, entry.fetchedAt, nil
+	}
+	call, ok := c.inflight[key]
+	if ok {
+		status = CacheCoalesced
+	} else {
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &portfolioCall{done: make(chan struct{}), cancel: cancel}
+		c.inflight[key] = call
+		go c.run(fetchCtx, key, call, address, chainIDs)
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		c.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody is left to use the result
+			call.cancel()
+			if c.inflight[key] == call {
+				delete(c.inflight, key)
+			}
+		}
+		c.mu.Unlock()
+		return nil, status, time.Time{}, ctx.Err()
+	}
+
+	if call.err != nil {
+		return nil, status, time.Time{}, call.err
+	}
+	req := *call.req
+	return &req, status, call.fetchedAt, nil
+}
+
+// fetchFresh fetches a portfolio for a request that must not share data with
+// other requests. Nobody else waits on the fetch, so it runs under the
+// request's own context.
+func (c *portfolioCache) fetchFresh(ctx context.Context, key, address string, chainIDs []int) (*RiskRequest, string, time.Time, error) {
+	fetched, err := c.provider.FetchPortfolio(ctx, address, chainIDs)
+	if err != nil {
+		return nil, CacheBypass, time.Time{}, err
+	}
+	fetchedAt := time.Now()
+
+	c.mu.Lock()
+	c.evictExpired()
+	c.entries[key] = cacheEntry{req: fetched, fetchedAt: fetchedAt}
+	c.mu.Unlock()
+
+	req := *fetched
+	return &req, CacheBypass, fetchedAt, nil
+}
+
+// run performs an upstream fetch and caches its result
+func (c *portfolioCache) run(ctx context.Context, key string, call *portfolioCall, address string, chainIDs []int) {
+	defer call.cancel()
+
+	started := time.Now()
+	call.req, call.err = c.provider.FetchPortfolio(ctx, address, chainIDs)
+	call.fetchedAt = time.Now()
+
+	c.mu.Lock()
+	if c.inflight[key] == call {
+		delete(c.inflight, key)
+	}
+	// A fresh fetch that started after this one may already have stored
+	// newer data
+	if entry, ok := c.entries[key]; call.err == nil && (!ok || entry.fetchedAt.Before(started)) {
+		c.evictExpired()
+		c.entries[key] = cacheEntry{req: call.req, fetchedAt: call.fetchedAt}
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// evictExpired drops stale entries; callers hold c.mu
+func (c *portfolioCache) evictExpired() {
+	for key, entry := range c.entries {
+		if time.Since(entry.fetchedAt) >= c.ttl {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// wantsFresh reports whether a request opted out of cached portfolios with
+// ?fresh=true or Cache-Control: no-cache, no-store or max-age=0
+func wantsFresh(r *http.Request) bool {
+	if fresh, err := strconv.ParseBool(r.URL.Query().Get("fresh")); err == nil && fresh {
+		return true
+	}
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "no-store", "max-age=0":
+			return true
+		}
+	}
+	return false
+}
+
+// fetchPortfolio loads a portfolio through the cache, when enabled, and
+// reports the cache status in the X-Cache and Age response headers
+func (s *Server) fetchPortfolio(w http.ResponseWriter, r *http.Request, address string, chainIDs []int) (*RiskRequest, error) {
+	req, status, fetchedAt, err := s.loadPortfolio(r.Context(), address, chainIDs, wantsFresh(r))
+	if status == "" {
+		return req, err
+	}
+
+	w.Header().Set("X-Cache", status)
+	if err == nil && status == CacheHit {
+		w.Header().Set("Age", strconv.Itoa(int(time.Since(fetchedAt).Seconds())))
+	}
+	return req, err
+}
+
+// loadPortfolio loads a portfolio through the cache, when enabled, and
+// returns its cache status; the status is empty when caching is disabled
+func (s *Server) loadPortfolio(ctx context.Context, address string, chainIDs []int, fresh bool) (*RiskRequest, string, time.Time, error) {
+	if s.cache == nil {
+		req, err := s.portfolio.FetchPortfolio(ctx, address, chainIDs)
+		return req, "", time.Time{}, err
+	}
+	return s.cache.fetch(ctx, address, chainIDs, fresh)
+}
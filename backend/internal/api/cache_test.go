@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingProvider counts fetches and holds each one until release is closed
+// or the fetch's context is done
+type blockingProvider struct {
+	calls     atomic.Int32
+	release   chan struct{}
+	cancelled chan struct{}
+}
+
+func newBlockingProvider() *blockingProvider {
+	return &blockingProvider{release: make(chan struct{}), cancelled: make(chan struct{}, 8)}
+}
+
+func (p *blockingProvider) FetchPortfolio(ctx context.Context, address string, chainIDs []int) (*RiskRequest, error) {
+	n := p.calls.Add(1)
+	select {
+	case <-p.release:
+		return &RiskRequest{Address: address, TokenBalances: TokenBalances{TotalCount: int(n)}}, nil
+	case <-ctx.Done():
+		p.cancelled <- struct{}{}
+		return nil, ctx.Err()
+	}
+}
+
+// waitForWaiters blocks until n callers wait on the in-flight fetch of key
+func waitForWaiters(t *testing.T, c *portfolioCache, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		call := c.inflight[key]
+		waiting := call != nil && call.waiters == n
+		c.mu.Unlock()
+		if waiting {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d callers never waited on %s", n, key)
+}
+
+func TestPortfolioCacheHitAndExpiry(t *testing.T) {
+	provider := newBlockingProvider()
+	close(provider.release)
+	c := newPortfolioCache(provider, time.Minute)
+	ctx := context.Background()
+	chains := []int{1, 8453}
+
+	for i, want := range []string{CacheMiss, CacheHit} {
+		req, status, _, err := c.fetch(ctx, sampleWallet, chains, false)
+		if err != nil || status != want || req.TokenBalances.TotalCount != 1 {
+			t.Fatalf("fetch %d = %+v, %s, %v; want the first fetch with %s", i, req, status, err, want)
+		}
+	}
+	if _, status, _, _ := c.fetch(ctx, sampleWallet, []int{1}, false); status != CacheMiss {
+		t.Errorf("other chain scope = %s, want %s", status, CacheMiss)
+	}
+
+	// Age the entry past the TTL
+	key := cacheKey(sampleWallet, chains)
+	c.mu.Lock()
+	entry := c.entries[key]
+	entry.fetchedAt = entry.fetchedAt.Add(-time.Minute)
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	req, status, _, err := c.fetch(ctx, sampleWallet, chains, false)
+	if err != nil || status != CacheMiss || req.TokenBalances.TotalCount != 3 {
+		t.Errorf("after expiry = %+v, %s, %v; want a third fetch with %s", req, status, err, CacheMiss)
+	}
+}
+
+func TestPortfolioCacheReturnsCopies(t *testing.T) {
+	provider := newBlockingProvider()
+	close(provider.release)
+	c := newPortfolioCache(provider, time.Minute)
+
+	first, _, _, _ := c.fetch(context.Background(), sampleWallet, nil, false)
+	first.Address = "changed"
+	second, _, _, _ := c.fetch(context.Background(), sampleWallet, nil, false)
+	if second.Address != sampleWallet {
+		t.Errorf("cached portfolio address = %q, want it untouched by callers", second.Address)
+	}
+}
+
+func TestPortfolioCacheCoalescesConcurrentMisses(t *testing.T) {
+	provider := newBlockingProvider()
+	c := newPortfolioCache(provider, time.Minute)
+	const callers = 5
+
+	statuses := make([]string, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, statuses[i], _, _ = c.fetch(context.Background(), sampleWallet, nil, false)
+		}(i)
+	}
+	waitForWaiters(t, c, cacheKey(sampleWallet, nil), callers)
+	close(provider.release)
+	wg.Wait()
+
+	if got := provider.calls.Load(); got != 1 {
+		t.Errorf("%d upstream fetches, want 1", got)
+	}
+	counts := make(map[string]int)
+	for _, status := range statuses {
+		counts[status]++
+	}
+	if counts[CacheMiss] != 1 || counts[CacheCoalesced] != callers-1 {
+		t.Errorf("statuses = %v, want one %s and %d %s", statuses, CacheMiss, callers-1, CacheCoalesced)
+	}
+}
+
+func TestPortfolioCacheWaiterCancellation(t *testing.T) {
+	provider := newBlockingProvider()
+	c := newPortfolioCache(provider, time.Minute)
+	key := cacheKey(sampleWallet, nil)
+
+	// The caller that started the fetch gives up; the other still gets it
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, _, _, err := c.fetch(firstCtx, sampleWallet, nil, false)
+		firstErr <- err
+	}()
+	waitForWaiters(t, c, key, 1)
+
+	type result struct {
+		req    *RiskRequest
+		status string
+		err    error
+	}
+	second := make(chan result, 1)
+	go func() {
+		req, status, _, err := c.fetch(context.Background(), sampleWallet, nil, false)
+		second <- result{req, status, err}
+	}()
+	waitForWaiters(t, c, key, 2)
+
+	cancelFirst()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller = %v, want context.Canceled", err)
+	}
+	waitForWaiters(t, c, key, 1)
+	close(provider.release)
+
+	got := <-second
+	if got.err != nil || got.status != CacheCoalesced || got.req.Address != sampleWallet {
+		t.Errorf("remaining caller = %+v, %s, %v; want the shared fetch", got.req, got.status, got.err)
+	}
+	if n := len(provider.cancelled); n != 0 {
+		t.Errorf("shared fetch was cancelled %d times, want it kept for the remaining caller", n)
+	}
+}
+
+func TestPortfolioCacheCancelsAbandonedFetch(t *testing.T) {
+	provider := newBlockingProvider()
+	defer close(provider.release)
+	c := newPortfolioCache(provider, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.fetch(ctx, sampleWallet, nil, false)
+	}()
+	waitForWaiters(t, c, cacheKey(sampleWallet, nil), 1)
+	cancel()
+	<-done
+
+	select {
+	case <-provider.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the fetch kept running after every caller gave up")
+	}
+}
+
+func TestPortfolioCacheFresh(t *testing.T) {
+	provider := newBlockingProvider()
+	c := newPortfolioCache(provider, time.Minute)
+	key := cacheKey(sampleWallet, nil)
+
+	// A fresh request does not join an in-flight fetch
+	shared := make(chan *RiskRequest, 1)
+	go func() {
+		req, _, _, _ := c.fetch(context.Background(), sampleWallet, nil, false)
+		shared <- req
+	}()
+	waitForWaiters(t, c, key, 1)
+
+	fresh := make(chan string, 1)
+	go func() {
+		_, status, _, _ := c.fetch(context.Background(), sampleWallet, nil, true)
+		fresh <- status
+	}()
+	for deadline := time.Now().Add(time.Second); provider.calls.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	close(provider.release)
+	if status := <-fresh; status != CacheBypass {
+		t.Errorf("fresh request during a fetch = %s, want %s", status, CacheBypass)
+	}
+	<-shared
+	if got := provider.calls.Load(); got != 2 {
+		t.Errorf("%d upstream fetches, want the fresh request to make its own", got)
+	}
+
+	// A fresh request skips the cached entry and replaces it
+	req, status, _, err := c.fetch(context.Background(), sampleWallet, nil, true)
+	if err != nil || status != CacheBypass || req.TokenBalances.TotalCount != 3 {
+		t.Errorf("fresh request = %+v, %s, %v; want a third fetch with %s", req, status, err, CacheBypass)
+	}
+	req, status, _, _ = c.fetch(context.Background(), sampleWallet, nil, false)
+	if status != CacheHit || req.TokenBalances.TotalCount != 3 {
+		t.Errorf("next request = %+v, %s; want the fresh portfolio from the cache", req, status)
+	}
+}
+
+func TestWantsFresh(t *testing.T) {
+	tests := []struct {
+		target       string
+		cacheControl string
+		want         bool
+	}{
+		{target: "/analyze", want: false},
+		{target: "/analyze?fresh=true", want: true},
+		{target: "/analyze?fresh=1", want: true},
+		{target: "/analyze?fresh=false", want: false},
+		{target: "/analyze", cacheControl: "no-cache", want: true},
+		{target: "/analyze", cacheControl: "private, Max-Age=0", want: true},
+		{target: "/analyze", cacheControl: "max-age=60", want: false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if tt.cacheControl != "" {
+			r.Header.Set("Cache-Control", tt.cacheControl)
+		}
+		if got := wantsFresh(r); got != tt.want {
+			t.Errorf("wantsFresh(%s, Cache-Control %q) = %v, want %v", tt.target, tt.cacheControl, got, tt.want)
+		}
+	}
+}
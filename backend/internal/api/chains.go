@@ -0,0 +1,141 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Chain is an EVM network Zapper reports balances for
+type Chain struct {
+	ID   int    `json:"chain_id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// chainRegistry maps chain IDs to the networks supported by portfolioV2
+var chainRegistry = map[int]Chain{
+	1:       {ID: 1, Name: "Ethereum", Slug: "ethereum"},
+	10:      {ID: 10, Name: "Optimism", Slug: "optimism"},
+	56:      {ID: 56, Name: "BNB Chain", Slug: "binance-smart-chain"},
+	100:     {ID: 100, Name: "Gnosis", Slug: "gnosis"},
+	130:     {ID: 130, Name: "Unichain", Slug: "unichain"},
+	137:     {ID: 137, Name: "Polygon", Slug: "polygon"},
+	250:     {ID: 250, Name: "Fantom", Slug: "fantom"},
+	324:     {ID: 324, Name: "zkSync", Slug: "zksync"},
+	8453:    {ID: 8453, Name: "Base", Slug: "base"},
+	34443:   {ID: 34443, Name: "Mode", Slug: "mode"},
+	42161:   {ID: 42161, Name: "Arbitrum", Slug: "arbitrum"},
+	43114:   {ID: 43114, Name: "Avalanche", Slug: "avalanche"},
+	59144:   {ID: 59144, Name: "Linea", Slug: "linea"},
+	81457:   {ID: 81457, Name: "Blast", Slug: "blast"},
+	534352:  {ID: 534352, Name: "Scroll", Slug: "scroll"},
+	7777777: {ID: 7777777, Name: "Zora", Slug: "zora"},
+}
+
+// ChainByID looks up a chain by its EVM chain ID
+func ChainByID(id int) (Chain, bool) {
+	chain, ok := chainRegistry[id]
+	return chain, ok
+}
+
+// ChainBySlug looks up a chain by its slug, e.g. "base"
+func ChainBySlug(slug string) (Chain, bool) {
+	for _, chain := range chainRegistry {
+		if strings.EqualFold(chain.Slug, slug) {
+			return chain, true
+		}
+	}
+	return Chain{}, false
+}
+
+// ParseChains parses a comma separated list of chain IDs or slugs, as accepted
+// by the chains= query parameter, into sorted, deduplicated chain IDs
+func ParseChains(value string) ([]int, error) {
+	seen := make(map[int]bool)
+	ids := make([]int, 0)
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var chain Chain
+		var ok bool
+		if id, err := strconv.Atoi(part); err == nil {
+			chain, ok = ChainByID(id)
+		} else {
+			chain, ok = ChainBySlug(part)
+		}
+		if !ok {
+			return nil, fmt.Errorf("unsupported chain %q", part)
+		}
+
+		if !seen[chain.ID] {
+			seen[chain.ID] = true
+			ids = append(ids, chain.ID)
+		}
+	}
+
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// networkForChain builds the Network for a chain ID reported by Zapper. Chains
+// missing from the registry keep Zapper's display name and a derived slug.
+func networkForChain(chainID int, name string) Network {
+	if chain, ok := ChainByID(chainID); ok {
+		return Network{Name: chain.Name, Slug: chain.Slug, ChainID: chain.ID}
+	}
+	return Network{
+		Name:    name,
+		Slug:    strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "-"),
+		ChainID: chainID,
+	}
+}
+
+// ChainSubtotal is the USD value a wallet holds on a single chain
+type ChainSubtotal struct {
+	ChainID         int     `json:"chain_id"`
+	Name            string  `json:"name"`
+	Slug            string  `json:"slug"`
+	TokenBalanceUSD float64 `json:"token_balance_usd"`
+	AppBalanceUSD   float64 `json:"app_balance_usd"`
+	TotalBalanceUSD float64 `json:"total_balance_usd"`
+}
+
+// chainSubtotals sums wallet tokens and app positions per chain, largest first
+func chainSubtotals(req RiskRequest) []ChainSubtotal {
+	byChain := make(map[string]*ChainSubtotal)
+	subtotal := func(network Network) *ChainSubtotal {
+		key := network.Slug
+		if _, ok := byChain[key]; !ok {
+			byChain[key] = &ChainSubtotal{ChainID: network.ChainID, Name: network.Name, Slug: network.Slug}
+		}
+		return byChain[key]
+	}
+
+	for _, token := range req.TokenBalances.ByToken {
+		subtotal(token.Network).TokenBalanceUSD += token.BalanceUSD
+	}
+	for _, app := range req.AppBalances.ByApp {
+		for _, position := range app.Balances {
+			subtotal(app.Network).AppBalanceUSD += position.BalanceUSD
+		}
+	}
+
+	subtotals := make([]ChainSubtotal, 0, len(byChain))
+	for _, s := range byChain {
+		s.TotalBalanceUSD = s.TokenBalanceUSD + s.AppBalanceUSD
+		subtotals = append(subtotals, *s)
+	}
+	sort.Slice(subtotals, func(i, j int) bool {
+		if subtotals[i].TotalBalanceUSD != subtotals[j].TotalBalanceUSD {
+			return subtotals[i].TotalBalanceUSD > subtotals[j].TotalBalanceUSD
+		}
+		return subtotals[i].Slug < subtotals[j].Slug
+	})
+	return subtotals
+}
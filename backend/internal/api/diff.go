@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// SnapshotDiff reports what changed in a wallet between two snapshots
+type SnapshotDiff struct {
+	Address   string          `json:"address"`
+	From      SnapshotSummary `json:"from"`
+	To        SnapshotSummary `json:"to"`
+	RiskScore ValueDelta      `json:"risk_score"`
+	// TotalBalanceUSD covers wallet tokens plus app positions
+	TotalBalanceUSD  ValueDelta      `json:"total_balance_usd"`
+	TokensAdded      []TokenDelta    `json:"tokens_added"`
+	TokensRemoved    []TokenDelta    `json:"tokens_removed"`
+	TokensChanged    []TokenDelta    `json:"tokens_changed"`
+	PositionsOpened  []PositionDelta `json:"positions_opened"`
+	PositionsClosed  []PositionDelta `json:"positions_closed"`
+	PositionsChanged []PositionDelta `json:"positions_changed"`
+}
+
+// ValueDelta is a value at both snapshots and its change
+type ValueDelta struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Delta float64 `json:"delta"`
+}
+
+func newValueDelta(from, to float64) ValueDelta {
+	return ValueDelta{From: from, To: to, Delta: to - from}
+}
+
+// TokenDelta is the change of a wallet token between two snapshots. Added
+// tokens have zero From values and removed tokens zero To values.
+type TokenDelta struct {
+	Symbol       string     `json:"symbol"`
+	TokenAddress string     `json:"token_address"`
+	Network      Network    `json:"network"`
+	Balance      ValueDelta `json:"balance"`
+	BalanceUSD   ValueDelta `json:"balance_usd"`
+}
+
+// PositionDelta is the change of a contract position between two snapshots
+type PositionDelta struct {
+	App        App        `json:"app"`
+	Network    Network    `json:"network"`
+	Address    string     `json:"address"`
+	Label      string     `json:"label,omitempty"`
+	BalanceUSD ValueDelta `json:"balance_usd"`
+}
+
+// tokenKey identifies a wallet token across snapshots
+func tokenKey(token TokenBalance) string {
+	return token.Network.Slug + ":" + strings.ToLower(token.TokenAddress)
+}
+
+// positionKey identifies a contract position across snapshots. Apps are
+// keyed by slug, as in the household merge, so a renamed app keeps its
+// positions.
+type positionKey struct {
+	app, network, address, label string
+}
+
+type positionEntry struct {
+	app      App
+	network  Network
+	position ContractPosition
+}
+
+func positionsOf(req RiskRequest) (map[positionKey]positionEntry, []positionKey) {
+	positions := make(map[positionKey]positionEntry)
+	var order []positionKey
+	for _, appBalance := range req.AppBalances.ByApp {
+		for _, contractPos := range appBalance.Balances {
+			key := positionKey{
+				app:     appSlug(appBalance.App.Slug, appBalance.App.DisplayName),
+				network: appBalance.Network.Slug,
+				address: strings.ToLower(contractPos.Address),
+				label:   contractPos.DisplayProps.Label,
+			}
+			if _, ok := positions[key]; !ok {
+				order = append(order, key)
+			}
+			positions[key] = positionEntry{app: appBalance.App, network: appBalance.Network, position: contractPos}
+		}
+	}
+	return positions, order
+}
+
+// DiffSnapshots compares the portfolios and scores of two snapshots
+func DiffSnapshots(from, to Snapshot) SnapshotDiff {
+	fromSummary, toSummary := from.Summary(), to.Summary()
+	diff := SnapshotDiff{
+		Address:          to.Address,
+		From:             fromSummary,
+		To:               toSummary,
+		RiskScore:        newValueDelta(from.Response.RiskScore, to.Response.RiskScore),
+		TotalBalanceUSD:  newValueDelta(fromSummary.TotalBalanceUSD, toSummary.TotalBalanceUSD),
+		TokensAdded:      []TokenDelta{},
+		TokensRemoved:    []TokenDelta{},
+		TokensChanged:    []TokenDelta{},
+		PositionsOpened:  []PositionDelta{},
+		PositionsClosed:  []PositionDelta{},
+		PositionsChanged: []PositionDelta{},
+	}
+
+	fromTokens := make(map[string]TokenBalance)
+	for _, token := range from.Request.TokenBalances.ByToken {
+		fromTokens[tokenKey(token)] = token
+	}
+	seen := make(map[string]bool)
+	for _, token := range to.Request.TokenBalances.ByToken {
+		key := tokenKey(token)
+		seen[key] = true
+		delta := TokenDelta{
+			Symbol:       token.Symbol,
+			TokenAddress: token.TokenAddress,
+			Network:      token.Network,
+			Balance:      newValueDelta(0, token.Balance),
+			BalanceUSD:   newValueDelta(0, token.BalanceUSD),
+		}
+		previous, ok := fromTokens[key]
+		if !ok {
+			diff.TokensAdded = append(diff.TokensAdded, delta)
+			continue
+		}
+		delta.Balance = newValueDelta(previous.Balance, token.Balance)
+		delta.BalanceUSD = newValueDelta(previous.BalanceUSD, token.BalanceUSD)
+		if delta.Balance.Delta != 0 || delta.BalanceUSD.Delta != 0 {
+			diff.TokensChanged = append(diff.TokensChanged, delta)
+		}
+	}
+	for _, token := range from.Request.TokenBalances.ByToken {
+		if seen[tokenKey(token)] {
+			continue
+		}
+		diff.TokensRemoved = append(diff.TokensRemoved, TokenDelta{
+			Symbol:       token.Symbol,
+			TokenAddress: token.TokenAddress,
+			Network:      token.Network,
+			Balance:      newValueDelta(token.Balance, 0),
+			BalanceUSD:   newValueDelta(token.BalanceUSD, 0),
+		})
+	}
+
+	fromPositions, fromOrder := positionsOf(from.Request)
+	toPositions, toOrder := positionsOf(to.Request)
+	for _, key := range toOrder {
+		entry := toPositions[key]
+		delta := PositionDelta{
+			App:        entry.app,
+			Network:    entry.network,
+			Address:    entry.position.Address,
+			Label:      entry.position.DisplayProps.Label,
+			BalanceUSD: newValueDelta(0, entry.position.BalanceUSD),
+		}
+		previous, ok := fromPositions[key]
+		if !ok {
+			diff.PositionsOpened = append(diff.PositionsOpened, delta)
+			continue
+		}
+		delta.BalanceUSD = newValueDelta(previous.position.BalanceUSD, entry.position.BalanceUSD)
+		if delta.BalanceUSD.Delta != 0 {
+			diff.PositionsChanged = append(diff.PositionsChanged, delta)
+		}
+	}
+	for _, key := range fromOrder {
+		if _, ok := toPositions[key]; ok {
+			continue
+		}
+		entry := fromPositions[key]
+		diff.PositionsClosed = append(diff.PositionsClosed, PositionDelta{
+			App:        entry.app,
+			Network:    entry.network,
+			Address:    entry.position.Address,
+			Label:      entry.position.DisplayProps.Label,
+			BalanceUSD: newValueDelta(entry.position.BalanceUSD, 0),
+		})
+	}
+
+	// Largest moves first
+	byTokenUSD := func(deltas []TokenDelta) {
+		sort.SliceStable(deltas, func(i, j int) bool {
+			return math.Abs(deltas[i].BalanceUSD.Delta) > math.Abs(deltas[j].BalanceUSD.Delta)
+		})
+	}
+	byPositionUSD := func(deltas []PositionDelta) {
+		sort.SliceStable(deltas, func(i, j int) bool {
+			return math.Abs(deltas[i].BalanceUSD.Delta) > math.Abs(deltas[j].BalanceUSD.Delta)
+		})
+	}
+	byTokenUSD(diff.TokensAdded)
+	byTokenUSD(diff.TokensRemoved)
+	byTokenUSD(diff.TokensChanged)
+	byPositionUSD(diff.PositionsOpened)
+	byPositionUSD(diff.PositionsClosed)
+	byPositionUSD(diff.PositionsChanged)
+
+	return diff
+}
+
+// GetDiff compares two snapshots of a wallet. to defaults to the latest
+// snapshot and from to the latest one preceding to with the same scope.
+// Snapshots of different scopes are not compared.
+func (s *Server) GetDiff(w http.ResponseWriter, r *http.Request) {
+	if s.snapshots == nil {
+		writeError(w, r, ErrSnapshotsDisabled)
+		return
+	}
+	address, ok := walletAddress(w, r)
+	if !ok {
+		return
+	}
+
+	fromID, toID := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if fromID == "" || toID == "" {
+		history, err := s.snapshots.History(address, 0)
+		if err != nil {
+			writeError(w, r, fmt.Errorf("failed to load history: %w", err))
+			return
+		}
+		// History is newest first, so the snapshot preceding to follows it
+		toIndex := 0
+		if toID != "" {
+			toIndex = slices.IndexFunc(history, func(summary SnapshotSummary) bool { return summary.ID == toID })
+			if toIndex < 0 {
+				writeError(w, r, fmt.Errorf("failed to load snapshot %s: %w", toID, ErrSnapshotNotFound))
+				return
+			}
+		} else if len(history) > 0 {
+			toID = history[0].ID
+		}
+		if fromID == "" && toIndex < len(history) {
+			// Only snapshots taken with the same scope are comparable
+			for _, summary := range history[toIndex+1:] {
+				if summary.Scope.Equal(history[toIndex].Scope) {
+					fromID = summary.ID
+					break
+				}
+			}
+		}
+		if fromID == "" || toID == "" {
+			writeError(w, r, fmt.Errorf("%w: at least two snapshots with the same chains and min_usd are needed to diff; pass from and to snapshot IDs", ErrSnapshotNotFound))
+			return
+		}
+	}
+
+	var snapshots [2]*Snapshot
+	for i, id := range []string{fromID, toID} {
+		snapshot, err := s.snapshots.Get(address, id)
+		if err != nil {
+			writeError(w, r, fmt.Errorf("failed to load snapshot %s: %w", id, err))
+			return
+		}
+		snapshots[i] = snapshot
+	}
+	if from, to := snapshots[0].Scope, snapshots[1].Scope; !from.Equal(to) {
+		writeError(w, r, fmt.Errorf("%w: snapshots %s (%s) and %s (%s) cover different holdings; diff snapshots taken with the same chains and min_usd",
+			ErrInvalidRequest, fromID, from, toID, to))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DiffSnapshots(*snapshots[0], *snapshots[1]))
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// closeDelta reports whether d goes from from to to, allowing for rounding
+// in the delta
+func closeDelta(d ValueDelta, from, to float64) bool {
+	return d.From == from && d.To == to && math.Abs(d.Delta-(to-from)) < 1e-9
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	base := Network{Name: "Base", Slug: "base", ChainID: 8453}
+	ethereum := Network{Name: "Ethereum", Slug: "ethereum", ChainID: 1}
+	token := func(symbol, address string, network Network, balance, usd float64) TokenBalance {
+		return TokenBalance{Symbol: symbol, TokenAddress: address, Network: network, Balance: balance, BalanceUSD: usd}
+	}
+	aave := App{DisplayName: "Aave V3", Slug: "aave-v3"}
+	aero := App{DisplayName: "Aerodrome", Slug: "aerodrome"}
+	position := func(address string, usd float64) ContractPosition {
+		return ContractPosition{Address: address, BalanceUSD: usd}
+	}
+
+	from := Snapshot{
+		ID:       "from",
+		Response: RiskResponse{RiskScore: 0.4},
+		Request: RiskRequest{
+			TokenBalances: TokenBalances{TotalBalanceUSD: 1510, ByToken: []TokenBalance{
+				token("WETH", "0x4200000000000000000000000000000000000006", base, 0.4, 1000),
+				token("USDC", "0x833589FCD6EDB6E08F4C7C32D4F71B54BDA02913", base, 500, 500),
+				token("DEGEN", "0xdegen", base, 1000, 10),
+				token("WETH", "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", ethereum, 0.1, 250),
+			}},
+			AppBalances: AppBalances{TotalBalanceUSD: 700, ByApp: []AppBalance{
+				{App: aave, Network: base, Balances: []ContractPosition{position("0xsupply", 500), position("0xsmall", 50)}},
+				{App: aero, Network: base, Balances: []ContractPosition{position("0xlock", 150)}},
+			}},
+		},
+	}
+	to := Snapshot{
+		ID:       "to",
+		Address:  sampleWallet,
+		Response: RiskResponse{RiskScore: 0.25},
+		Request: RiskRequest{
+			TokenBalances: TokenBalances{TotalBalanceUSD: 1800, ByToken: []TokenBalance{
+				// The same tokens in another order and address case
+				token("USDC", "0x833589fcd6edb6e08f4c7c32d4f71b54bda02913", base, 500, 500),
+				token("WETH", "0x4200000000000000000000000000000000000006", base, 0.5, 1250),
+				token("AERO", "0xaero", base, 20, 17),
+				token("cbBTC", "0xcbbtc", base, 0.0005, 33),
+			}},
+			AppBalances: AppBalances{TotalBalanceUSD: 900, ByApp: []AppBalance{
+				{App: aave, Network: base, Balances: []ContractPosition{position("0xsmall", 40), position("0xsupply", 800)}},
+				{App: aave, Network: ethereum, Balances: []ContractPosition{position("0xsupply", 60)}},
+			}},
+		},
+	}
+
+	diff := DiffSnapshots(from, to)
+	if diff.Address != sampleWallet || diff.From.ID != "from" || diff.To.ID != "to" {
+		t.Errorf("diff of %s from %s to %s, want %s from from to to", diff.Address, diff.From.ID, diff.To.ID, sampleWallet)
+	}
+	if !closeDelta(diff.RiskScore, 0.4, 0.25) {
+		t.Errorf("risk score = %+v, want 0.4 to 0.25", diff.RiskScore)
+	}
+	if !closeDelta(diff.TotalBalanceUSD, 2210, 2700) {
+		t.Errorf("total balance = %+v, want 2210 to 2700 USD", diff.TotalBalanceUSD)
+	}
+
+	tokenMoves := func(deltas []TokenDelta) []string {
+		moves := make([]string, len(deltas))
+		for i, d := range deltas {
+			moves[i] = fmt.Sprintf("%s@%s %+g", d.Symbol, d.Network.Slug, d.BalanceUSD.Delta)
+		}
+		return moves
+	}
+	positionMoves := func(deltas []PositionDelta) []string {
+		moves := make([]string, len(deltas))
+		for i, d := range deltas {
+			moves[i] = fmt.Sprintf("%s@%s %s %+g", d.App.Slug, d.Network.Slug, d.Address, d.BalanceUSD.Delta)
+		}
+		return moves
+	}
+
+	// Each list is ordered by the size of the USD move, whatever its sign
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{name: "tokens added", got: tokenMoves(diff.TokensAdded), want: []string{"cbBTC@base +33", "AERO@base +17"}},
+		{name: "tokens removed", got: tokenMoves(diff.TokensRemoved), want: []string{"WETH@ethereum -250", "DEGEN@base -10"}},
+		{name: "tokens changed", got: tokenMoves(diff.TokensChanged), want: []string{"WETH@base +250"}},
+		{name: "positions opened", got: positionMoves(diff.PositionsOpened), want: []string{"aave-v3@ethereum 0xsupply +60"}},
+		{name: "positions closed", got: positionMoves(diff.PositionsClosed), want: []string{"aerodrome@base 0xlock -150"}},
+		{name: "positions changed", got: positionMoves(diff.PositionsChanged), want: []string{"aave-v3@base 0xsupply +300", "aave-v3@base 0xsmall -10"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if changed := diff.TokensChanged[0]; !closeDelta(changed.Balance, 0.4, 0.5) {
+		t.Errorf("WETH balance = %+v, want 0.4 to 0.5", changed.Balance)
+	}
+}
+
+func TestDiffSnapshotsKeepsPositionsOfRenamedApps(t *testing.T) {
+	base := Network{Name: "Base", Slug: "base", ChainID: 8453}
+	snapshot := func(displayName string, balanceUSD float64) Snapshot {
+		return Snapshot{Address: sampleWallet, Request: RiskRequest{AppBalances: AppBalances{ByApp: []AppBalance{{
+			App:      App{DisplayName: displayName, Slug: "aave-v3"},
+			Network:  base,
+			Balances: []ContractPosition{{Address: "0xa238dd80c259a72e81d7e4664a9801593f98d1c5", BalanceUSD: balanceUSD}},
+		}}}}}
+	}
+
+	diff := DiffSnapshots(snapshot("Aave V3", 500), snapshot("Aave", 600))
+	if len(diff.PositionsOpened) != 0 || len(diff.PositionsClosed) != 0 || len(diff.PositionsChanged) != 1 {
+		t.Fatalf("renamed app: %d opened, %d closed, %d changed; want the position changed",
+			len(diff.PositionsOpened), len(diff.PositionsClosed), len(diff.PositionsChanged))
+	}
+	if changed := diff.PositionsChanged[0]; changed.App.DisplayName != "Aave" || changed.BalanceUSD.Delta != 100 {
+		t.Errorf("changed position = %+v, want Aave up 100 USD", changed)
+	}
+}
+
+// memoryStore is a SnapshotStore for a single test; snapshots are saved in
+// chronological order
+type memoryStore struct {
+	snapshots []Snapshot
+}
+
+func (m *memoryStore) NewID() string {
+	return fmt.Sprintf("snapshot-%d", len(m.snapshots)+1)
+}
+
+func (m *memoryStore) Save(snapshot Snapshot) error {
+	m.snapshots = append(m.snapshots, snapshot)
+	return nil
+}
+
+func (m *memoryStore) History(address string, limit int) ([]SnapshotSummary, error) {
+	var history []SnapshotSummary
+	for i := len(m.snapshots) - 1; i >= 0; i-- {
+		if m.snapshots[i].Address == address {
+			history = append(history, m.snapshots[i].Summary())
+		}
+	}
+	if limit > 0 && len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+func (m *memoryStore) Get(address, id string) (*Snapshot, error) {
+	for _, snapshot := range m.snapshots {
+		if snapshot.Address == address && snapshot.ID == id {
+			return &snapshot, nil
+		}
+	}
+	return nil, ErrSnapshotNotFound
+}
+
+// newDiffServer serves diffs of the given snapshots of sampleWallet
+func newDiffServer(t *testing.T, snapshots ...Snapshot) *Server {
+	t.Helper()
+	store := &memoryStore{}
+	for _, snapshot := range snapshots {
+		snapshot.ID = store.NewID()
+		snapshot.Address = sampleWallet
+		store.Save(snapshot)
+	}
+	server, err := NewServer(Config{
+		Portfolio:     emptyProvider{},
+		Engines:       map[string]RiskEngine{"fixed": fixedEngine{}},
+		DefaultEngine: "fixed",
+		Snapshots:     store,
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return server
+}
+
+func getDiff(server *Server, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/wallets/"+sampleWallet+"/diff?"+query, nil)
+	r.SetPathValue("address", sampleWallet)
+	rec := httptest.NewRecorder()
+	server.GetDiff(rec, r)
+	return rec
+}
+
+func TestGetDiffComparesSnapshotsOfOneScope(t *testing.T) {
+	base := SnapshotScope{Chains: []int{8453}}
+	server := newDiffServer(t,
+		Snapshot{},
+		Snapshot{Scope: base},
+		Snapshot{Scope: SnapshotScope{MinUSD: 5}},
+		Snapshot{},
+	)
+
+	tests := []struct {
+		query    string
+		status   int
+		code     string
+		message  string
+		from, to string
+	}{
+		// The Base-only and dust-filtered snapshots in between are skipped
+		{query: "", status: http.StatusOK, from: "snapshot-1", to: "snapshot-4"},
+		{query: "from=snapshot-1&to=snapshot-4", status: http.StatusOK, from: "snapshot-1", to: "snapshot-4"},
+		{query: "from=snapshot-2", status: http.StatusBadRequest, code: CodeInvalidRequest},
+		{query: "from=snapshot-3&to=snapshot-1", status: http.StatusBadRequest, code: CodeInvalidRequest},
+		{query: "to=snapshot-2", status: http.StatusNotFound, code: CodeNotFound},
+		{query: "to=snapshot-9", status: http.StatusNotFound, code: CodeNotFound, message: "snapshot-9"},
+		{query: "from=snapshot-1&to=snapshot-9", status: http.StatusNotFound, code: CodeNotFound, message: "snapshot-9"},
+	}
+	for _, tt := range tests {
+		rec := getDiff(server, tt.query)
+		if rec.Code != tt.status {
+			t.Errorf("%q: status %d, want %d: %s", tt.query, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		if tt.code != "" {
+			var resp ErrorResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if resp.Code != tt.code || !strings.Contains(resp.Message, tt.message) {
+				t.Errorf("%q: %s %q, want %s mentioning %q", tt.query, resp.Code, resp.Message, tt.code, tt.message)
+			}
+			continue
+		}
+		var diff SnapshotDiff
+		if err := json.NewDecoder(rec.Body).Decode(&diff); err != nil {
+			t.Fatalf("%q: decode diff: %v", tt.query, err)
+		}
+		if diff.From.ID != tt.from || diff.To.ID != tt.to {
+			t.Errorf("%q: diffed %s to %s, want %s to %s", tt.query, diff.From.ID, diff.To.ID, tt.from, tt.to)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// Names of the built-in risk engines selectable with ?engine=
+const (
+	EngineASI1   = "asi1"
+	EngineLLM    = "llm"
+	EngineAgent  = "agent"
+	EngineNative = "native"
+)
+
+// RiskEngine scores a portfolio and produces token recommendations. Engines
+// that call upstreams stop when ctx, the request context, is done.
+type RiskEngine interface {
+	Analyze(ctx context.Context, req RiskRequest) (*RiskResponse, error)
+}
+
+// engine looks up a registered engine by name, falling back to the default
+// engine when name is empty
+func (s *Server) engine(name string) (string, RiskEngine, error) {
+	if name == "" {
+		name = s.defaultEngine
+	}
+	engine, ok := s.engines[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown risk engine %q", name)
+	}
+	return name, engine, nil
+}
+
+// analyze scores a portfolio with the named engines. Several names run an
+// ensemble analysis and an empty list uses the default engine.
+func (s *Server) analyze(ctx context.Context, names []string, riskRequest RiskRequest) (*RiskResponse, error) {
+	riskResponse, err := s.runEngines(ctx, names, riskRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if riskResponse.Factors != nil {
+		riskResponse.FactorsSource = FactorsFromEngine
+	} else if s.factors != nil {
+		riskResponse.Factors = s.factors.Factors(riskRequest)
+		riskResponse.FactorsSource = FactorsFromRules
+	}
+	if s.grounder != nil {
+		s.grounder.Ground(riskRequest, riskResponse)
+	}
+
+	return riskResponse, nil
+}
+
+// runEngines dispatches to a single engine or to an ensemble of engines
+func (s *Server) runEngines(ctx context.Context, names []string, riskRequest RiskRequest) (*RiskResponse, error) {
+	if len(names) > 1 {
+		return s.analyzeEnsemble(ctx, names, riskRequest)
+	}
+
+	name := ""
+	if len(names) == 1 {
+		name = names[0]
+	}
+	engineName, engine, err := s.engine(name)
+	if err != nil {
+		return nil, err
+	}
+
+	riskResponse, err := engine.Analyze(ctx, riskRequest)
+	if err != nil {
+		return nil, fmt.Errorf("risk engine %s failed: %w", engineName, err)
+	}
+	riskResponse.Engine = engineName
+
+	return riskResponse, nil
+}
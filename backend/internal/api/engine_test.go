@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"testing"
+)
+
+type emptyProvider struct{}
+
+func (emptyProvider) FetchPortfolio(ctx context.Context, address string, chainIDs []int) (*RiskRequest, error) {
+	return &RiskRequest{Address: address}, nil
+}
+
+type fixedEngine struct{ resp RiskResponse }
+
+func (e fixedEngine) Analyze(ctx context.Context, req RiskRequest) (*RiskResponse, error) {
+	resp := e.resp
+	return &resp, nil
+}
+
+type failingEngine struct{ err error }
+
+func (e failingEngine) Analyze(ctx context.Context, req RiskRequest) (*RiskResponse, error) {
+	return nil, e.err
+}
+
+type fixedFactors []RiskFactor
+
+func (f fixedFactors) Factors(req RiskRequest) []RiskFactor {
+	return f
+}
+
+func TestAnalyzeLabelsFactorsSource(t *testing.T) {
+	own := []RiskFactor{{Name: "concentration", Contribution: 0.42}}
+	server, err := NewServer(Config{
+		Portfolio: emptyProvider{},
+		Engines: map[string]RiskEngine{
+			"scored":    fixedEngine{RiskResponse{RiskScore: 0.42}},
+			"explained": fixedEngine{RiskResponse{RiskScore: 0.42, Factors: own}},
+		},
+		DefaultEngine: "scored",
+		Factors:       fixedFactors{{Name: "concentration", Contribution: 0.15}},
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	tests := []struct {
+		engines      []string
+		source       string
+		contribution float64
+	}{
+		{engines: []string{"scored"}, source: FactorsFromRules, contribution: 0.15},
+		{engines: []string{"explained"}, source: FactorsFromEngine, contribution: 0.42},
+		{engines: []string{"scored", "explained"}, source: FactorsFromRules, contribution: 0.15},
+	}
+	for _, tt := range tests {
+		resp, err := server.analyze(context.Background(), tt.engines, RiskRequest{Address: "0x1"})
+		if err != nil {
+			t.Fatalf("%v: %v", tt.engines, err)
+		}
+		if resp.FactorsSource != tt.source || len(resp.Factors) != 1 || resp.Factors[0].Contribution != tt.contribution {
+			t.Errorf("%v: factors %+v from %q, want contribution %v from %q", tt.engines, resp.Factors, resp.FactorsSource, tt.contribution, tt.source)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// EngineEnsemble is the engine name reported for ensemble analyses
+const EngineEnsemble = "ensemble"
+
+// DefaultDivergenceThreshold is the score spread above which engines are
+// considered to disagree sharply
+const DefaultDivergenceThreshold = 0.3
+
+// EngineResult is a single engine's verdict within an ensemble analysis
+type EngineResult struct {
+	Engine            string   `json:"engine"`
+	Path              string   `json:"path,omitempty"`
+	PromptVersion     string   `json:"prompt_version,omitempty"`
+	RecommendedTokens []string `json:"recommended_tokens,omitempty"`
+	RiskScore         float64  `json:"risk_score"`
+	Reasoning         []string `json:"reasoning,omitempty"`
+	// Error and ErrorCode describe a failed engine like an ErrorResponse
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// EnsembleResult reconciles the verdicts of several engines
+type EnsembleResult struct {
+	Engines       []EngineResult `json:"engines"`
+	CombinedScore float64        `json:"combined_score"`
+	// Disagreement is the spread between the highest and lowest engine score
+	Disagreement float64 `json:"disagreement"`
+	// Divergent is set when Disagreement reaches the divergence threshold
+	Divergent bool `json:"divergent"`
+}
+
+// parseEngineNames splits a comma separated ?engine= value, dropping blanks
+// and duplicates
+func parseEngineNames(value string) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// analyzeEnsemble runs the named engines concurrently and combines their
+// scores. Engines that fail are reported alongside the others; the analysis
+// only fails when every engine does.
+func (s *Server) analyzeEnsemble(ctx context.Context, names []string, riskRequest RiskRequest) (*RiskResponse, error) {
+	engines := make([]RiskEngine, len(names))
+	for i, name := range names {
+		_, engine, err := s.engine(name)
+		if err != nil {
+			return nil, err
+		}
+		engines[i] = engine
+	}
+
+	results := make([]EngineResult, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range engines {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result := EngineResult{Engine: names[i]}
+			resp, err := engines[i].Analyze(ctx, riskRequest)
+			if err != nil {
+				result.Error, result.ErrorCode = partialError("Ensemble engine "+names[i], err)
+				errs[i] = fmt.Errorf("risk engine %s failed: %w", names[i], err)
+			} else {
+				result.Path = resp.Path
+				result.PromptVersion = resp.PromptVersion
+				result.RecommendedTokens = resp.RecommendedTokens
+				result.RiskScore = resp.RiskScore
+				result.Reasoning = resp.Reasoning
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+
+	response, err := s.reconcile(results)
+	if err != nil {
+		return nil, &ensembleError{err: err, engineErrs: errs}
+	}
+	return response, nil
+}
+
+// ensembleError is an ensemble analysis in which every engine failed. It
+// unwraps to the engine errors so that the failure can be classified.
+type ensembleError struct {
+	err        error
+	engineErrs []error
+}
+
+func (e *ensembleError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ensembleError) Unwrap() []error {
+	return append([]error{e.err}, e.engineErrs...)
+}
+
+// reconcile merges engine results into a single response. The combined score
+// is the mean of the successful engines' scores.
+func (s *Server) reconcile(results []EngineResult) (*RiskResponse, error) {
+	ensemble := &EnsembleResult{Engines: results}
+	response := &RiskResponse{
+		Engine:            EngineEnsemble,
+		RecommendedTokens: make([]string, 0),
+		Reasoning:         make([]string, 0),
+		Ensemble:          ensemble,
+	}
+
+	seenTokens := make(map[string]bool)
+	minScore, maxScore := math.Inf(1), math.Inf(-1)
+	succeeded := 0
+	failures := make([]string, 0)
+
+	for _, result := range results {
+		if result.Error != "" {
+			failures = append(failures, fmt.Sprintf("%s: %s", result.Engine, result.Error))
+			continue
+		}
+		succeeded++
+		ensemble.CombinedScore += result.RiskScore
+		minScore = math.Min(minScore, result.RiskScore)
+		maxScore = math.Max(maxScore, result.RiskScore)
+
+		for _, token := range result.RecommendedTokens {
+			if !seenTokens[token] {
+				seenTokens[token] = true
+				response.RecommendedTokens = append(response.RecommendedTokens, token)
+			}
+		}
+		for _, reason := range result.Reasoning {
+			response.Reasoning = append(response.Reasoning, fmt.Sprintf("[%s] %s", result.Engine, reason))
+		}
+	}
+
+	if succeeded == 0 {
+		return nil, fmt.Errorf("all risk engines failed: %s", strings.Join(failures, "; "))
+	}
+
+	ensemble.CombinedScore /= float64(succeeded)
+	ensemble.Disagreement = maxScore - minScore
+	ensemble.Divergent = succeeded > 1 && ensemble.Disagreement >= s.divergenceThreshold
+	response.RiskScore = ensemble.CombinedScore
+
+	if ensemble.Divergent {
+		response.Reasoning = append([]string{fmt.Sprintf(
+			"Engines disagree sharply: risk scores range from %.2f to %.2f - manual review recommended",
+			minScore, maxScore,
+		)}, response.Reasoning...)
+	}
+
+	return response, nil
+}
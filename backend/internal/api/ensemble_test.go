@@ -0,0 +1,116 @@
+package api
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// closeTo compares scores, which averaging leaves with rounding errors
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestReconcile(t *testing.T) {
+	failed := func(engine string) EngineResult {
+		return EngineResult{Engine: engine, Error: "timed out", ErrorCode: CodeUpstreamTimeout}
+	}
+	scored := func(engine string, score float64, tokens ...string) EngineResult {
+		return EngineResult{Engine: engine, RiskScore: score, RecommendedTokens: tokens, Reasoning: []string{engine + " reason"}}
+	}
+
+	tests := []struct {
+		name      string
+		threshold float64
+		results   []EngineResult
+		combined  float64
+		spread    float64
+		divergent bool
+		tokens    []string
+		reasoning []string
+	}{
+		{
+			name:      "mean and spread",
+			threshold: 0.5,
+			results:   []EngineResult{scored("native", 0.2, "USDC"), scored("asi1", 0.4, "ETH", "USDC"), scored("agent", 0.6)},
+			combined:  0.4,
+			spread:    0.4,
+			tokens:    []string{"USDC", "ETH"},
+			reasoning: []string{"[native] native reason", "[asi1] asi1 reason", "[agent] agent reason"},
+		},
+		{
+			name:      "spread on the threshold",
+			threshold: 0.25,
+			results:   []EngineResult{scored("native", 0.5), scored("asi1", 0.75)},
+			combined:  0.625,
+			spread:    0.25,
+			divergent: true,
+			tokens:    []string{},
+			reasoning: []string{
+				"Engines disagree sharply: risk scores range from 0.50 to 0.75 - manual review recommended",
+				"[native] native reason", "[asi1] asi1 reason",
+			},
+		},
+		{
+			name:      "spread below the threshold",
+			threshold: 0.25,
+			results:   []EngineResult{scored("native", 0.5), scored("asi1", 0.7)},
+			combined:  0.6,
+			spread:    0.2,
+			tokens:    []string{},
+			reasoning: []string{"[native] native reason", "[asi1] asi1 reason"},
+		},
+		{
+			name:      "failed engine left out",
+			threshold: 0.25,
+			results:   []EngineResult{scored("native", 0.2, "BTC"), failed("asi1"), scored("agent", 0.4)},
+			combined:  0.3,
+			spread:    0.2,
+			tokens:    []string{"BTC"},
+			reasoning: []string{"[native] native reason", "[agent] agent reason"},
+		},
+		{
+			// One engine cannot disagree with itself, whatever the threshold
+			name:      "single surviving engine",
+			threshold: 0.0001,
+			results:   []EngineResult{failed("native"), scored("asi1", 0.9, "USDC")},
+			combined:  0.9,
+			tokens:    []string{"USDC"},
+			reasoning: []string{"[asi1] asi1 reason"},
+		},
+	}
+	for _, tt := range tests {
+		s := &Server{divergenceThreshold: tt.threshold}
+		resp, err := s.reconcile(tt.results)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		ensemble := resp.Ensemble
+		if !closeTo(resp.RiskScore, tt.combined) || !closeTo(ensemble.CombinedScore, tt.combined) {
+			t.Errorf("%s: score %v, combined %v; want %v", tt.name, resp.RiskScore, ensemble.CombinedScore, tt.combined)
+		}
+		if !closeTo(ensemble.Disagreement, tt.spread) || ensemble.Divergent != tt.divergent {
+			t.Errorf("%s: disagreement %v (divergent %v), want %v (divergent %v)",
+				tt.name, ensemble.Disagreement, ensemble.Divergent, tt.spread, tt.divergent)
+		}
+		if !reflect.DeepEqual(resp.RecommendedTokens, tt.tokens) || !reflect.DeepEqual(resp.Reasoning, tt.reasoning) {
+			t.Errorf("%s: recommended %q because %q, want %q because %q", tt.name, resp.RecommendedTokens, resp.Reasoning, tt.tokens, tt.reasoning)
+		}
+		if resp.Engine != EngineEnsemble || len(ensemble.Engines) != len(tt.results) {
+			t.Errorf("%s: engine %q with %d results, want %q with every engine's result", tt.name, resp.Engine, len(ensemble.Engines), EngineEnsemble)
+		}
+	}
+}
+
+func TestReconcileAllFailed(t *testing.T) {
+	s := &Server{divergenceThreshold: DefaultDivergenceThreshold}
+	_, err := s.reconcile([]EngineResult{
+		{Engine: "native", Error: "boom"},
+		{Engine: "asi1", Error: "timed out"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "native: boom") || !strings.Contains(err.Error(), "asi1: timed out") {
+		t.Errorf("reconcile = %v, want an error naming every failed engine", err)
+	}
+}
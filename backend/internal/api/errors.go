@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dex-analyzer/internal/upstream"
+)
+
+// RequestIDHeader carries the ID that error responses report as request_id.
+// A client-supplied ID is kept; otherwise one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
+// Error codes of ErrorResponse
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeInvalidAddress      = "invalid_address"
+	CodeInvalidName         = "invalid_name"
+	CodeNotFound            = "not_found"
+	CodeNameNotFound        = "name_not_found"
+	CodeUpstreamZapper      = "upstream_zapper"
+	CodeUpstreamLLM         = "upstream_llm"
+	CodeUpstreamAgent       = "upstream_agent"
+	CodeUpstreamRPC         = "upstream_rpc"
+	CodeLLMNoToolCall       = "llm_no_tool_call"
+	CodeUpstreamRateLimited = "upstream_rate_limited"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeUpstreamTimeout     = "upstream_timeout"
+	CodeInternal            = "internal"
+)
+
+// Errors classified by writeError
+var (
+	// ErrInvalidRequest covers malformed query parameters and bodies
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrInvalidAddress = errors.New("invalid Ethereum address")
+	ErrInvalidName    = errors.New("invalid ENS name")
+	// ErrNameNotFound is returned by a NameResolver for names without an
+	// address
+	ErrNameNotFound = errors.New("name does not resolve to an address")
+	// ErrSnapshotsDisabled is returned by the wallet endpoints when no
+	// snapshot store is configured
+	ErrSnapshotsDisabled = errors.New("snapshot store is disabled")
+	ErrUpstreamZapper    = errors.New("Zapper request failed")
+	ErrUpstreamLLM       = errors.New("LLM request failed")
+	ErrUpstreamAgent     = errors.New("risk advisor request failed")
+	ErrUpstreamRPC       = errors.New("JSON-RPC request failed")
+	// ErrLLMNoToolCall is returned when the model answers without calling
+	// the analysis tool
+	ErrLLMNoToolCall = errors.New("model did not return a tool call")
+)
+
+// UpstreamError is a failed call to a third-party API. Kind is one of the
+// ErrUpstream errors; Err holds the details, which are logged but never
+// returned to API clients.
+type UpstreamError struct {
+	// Upstream names the API: zapper, asi1, llm, agent, ens or basenames
+	Upstream string
+	Kind     error
+	Err      error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// ErrorResponse is the JSON body of every failed request
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Upstream names the third-party API that caused the failure, if any
+	Upstream  string `json:"upstream,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+// RequestID returns the request's ID, assigning one and echoing it in the
+// response headers on first use
+func RequestID(w http.ResponseWriter, r *http.Request) string {
+	if id := w.Header().Get(RequestIDHeader); id != "" {
+		return id
+	}
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		id = uuid.NewString()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
+
+// writeError maps err to a status code and writes the error envelope.
+// Server-side failures are logged with the request ID; only the client
+// errors' own messages are returned verbatim.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, resp, retryAfter := classifyError(err)
+	resp.RequestID = RequestID(w, r)
+	if status >= http.StatusInternalServerError {
+		log.Printf("Request %s failed with %d %s: %v", resp.RequestID, status, resp.Code, err)
+	}
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// classifyError picks the status, code and client-safe message for err
+func classifyError(err error) (int, ErrorResponse, time.Duration) {
+	var upstreamErr *UpstreamError
+	name := ""
+	if errors.As(err, &upstreamErr) {
+		name = upstreamErr.Upstream
+	}
+
+	var circuitErr *upstream.CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		if name == "" {
+			name = circuitErr.Upstream
+		}
+		return http.StatusServiceUnavailable, ErrorResponse{
+			Code:     CodeUpstreamUnavailable,
+			Message:  fmt.Sprintf("%s is temporarily unavailable after repeated failures; retry in %s", name, circuitErr.RetryAfter.Round(time.Second)),
+			Upstream: name,
+		}, circuitErr.RetryAfter
+	}
+
+	var statusErr *upstream.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests {
+		return http.StatusServiceUnavailable, ErrorResponse{
+			Code:     CodeUpstreamRateLimited,
+			Message:  fmt.Sprintf("%s is rate limiting requests; try again later", nameOr(name, "an upstream API")),
+			Upstream: name,
+		}, 0
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, ErrorResponse{
+			Code:     CodeUpstreamTimeout,
+			Message:  fmt.Sprintf("%s did not respond in time", nameOr(name, "an upstream API")),
+			Upstream: name,
+		}, 0
+	}
+
+	switch {
+	case errors.Is(err, ErrLLMNoToolCall):
+		return http.StatusBadGateway, ErrorResponse{
+			Code:     CodeLLMNoToolCall,
+			Message:  fmt.Sprintf("%s did not return a risk analysis", nameOr(name, "the model")),
+			Upstream: name,
+		}, 0
+	case errors.Is(err, ErrUpstreamZapper):
+		return http.StatusBadGateway, ErrorResponse{
+			Code:     CodeUpstreamZapper,
+			Message:  "failed to fetch portfolio data from Zapper",
+			Upstream: name,
+		}, 0
+	case errors.Is(err, ErrUpstreamLLM):
+		return http.StatusBadGateway, ErrorResponse{
+			Code:     CodeUpstreamLLM,
+			Message:  fmt.Sprintf("%s risk analysis failed", nameOr(name, "LLM")),
+			Upstream: name,
+		}, 0
+	case errors.Is(err, ErrUpstreamAgent):
+		return http.StatusBadGateway, ErrorResponse{
+			Code:     CodeUpstreamAgent,
+			Message:  "risk advisor agent analysis failed",
+			Upstream: name,
+		}, 0
+	case errors.Is(err, ErrUpstreamRPC):
+		return http.StatusBadGateway, ErrorResponse{
+			Code:     CodeUpstreamRPC,
+			Message:  fmt.Sprintf("failed to resolve the name through %s", nameOr(name, "JSON-RPC")),
+			Upstream: name,
+		}, 0
+	case errors.Is(err, ErrInvalidAddress):
+		return http.StatusBadRequest, ErrorResponse{Code: CodeInvalidAddress, Message: err.Error()}, 0
+	case errors.Is(err, ErrInvalidName):
+		return http.StatusBadRequest, ErrorResponse{Code: CodeInvalidName, Message: err.Error()}, 0
+	case errors.Is(err, ErrNameNotFound):
+		return http.StatusNotFound, ErrorResponse{Code: CodeNameNotFound, Message: err.Error()}, 0
+	case errors.Is(err, ErrInvalidRequest):
+		return http.StatusBadRequest, ErrorResponse{Code: CodeInvalidRequest, Message: err.Error()}, 0
+	case errors.Is(err, ErrSnapshotNotFound), errors.Is(err, ErrSnapshotsDisabled):
+		return http.StatusNotFound, ErrorResponse{Code: CodeNotFound, Message: err.Error()}, 0
+	}
+
+	return http.StatusInternalServerError, ErrorResponse{Code: CodeInternal, Message: "internal server error"}, 0
+}
+
+// partialError logs the failure of one part of a response, such as an engine
+// of an ensemble or a wallet of a batch, and returns the client-safe message
+// and code reported in its place. Upstream details stay in the logs.
+func partialError(part string, err error) (string, string) {
+	log.Printf("%s failed: %v", part, err)
+	_, resp, _ := classifyError(err)
+	return resp.Message, resp.Code
+}
+
+func nameOr(name, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// invalidRequest marks err as a client error
+func invalidRequest(err error) error {
+	return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+}
@@ -0,0 +1,11 @@
+package api
+
+// Fakes shared with the external api_test package, which cannot be part of
+// package api because it imports resolvers that import it
+
+type (
+	EmptyProvider = emptyProvider
+	FixedEngine   = fixedEngine
+)
+
+const SampleWallet = sampleWallet
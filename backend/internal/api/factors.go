@@ -0,0 +1,33 @@
+package api
+
+// RiskFactor is one component of a portfolio's risk score
+type RiskFactor struct {
+	Name string `json:"name"`
+	// Metric is the raw value the factor is derived from, e.g. the HHI
+	Metric float64 `json:"metric"`
+	// Band is the threshold band the metric falls into: low, medium or high
+	Band            string  `json:"band"`
+	MediumThreshold float64 `json:"medium_threshold"`
+	HighThreshold   float64 `json:"high_threshold"`
+	// Contribution is the amount the factor adds to the risk score
+	Contribution float64 `json:"contribution"`
+	Description  string  `json:"description,omitempty"`
+}
+
+// Values of RiskResponse.FactorsSource
+const (
+	// FactorsFromEngine means the scoring engine produced the factors, so
+	// their contributions add up to its risk score
+	FactorsFromEngine = "engine"
+	// FactorsFromRules means the factors come from the deterministic rules
+	// because the engine only returned a score. Their contributions are the
+	// rules' view and need not add up to the engine's risk score.
+	FactorsFromRules = "native_rules"
+)
+
+// FactorAnalyzer breaks a portfolio down into structured risk factors. It is
+// used to attach an auditable breakdown to responses from engines, such as the
+// LLM, that only return a single score.
+type FactorAnalyzer interface {
+	Factors(req RiskRequest) []RiskFactor
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Zapper provider modes
+const (
+	ZapperModeLive   = "live"
+	ZapperModeReplay = "replay"
+	ZapperModeRecord = "record"
+)
+
+// DefaultZapperFixturesDir is the bundled fixture directory, relative to the
+// backend module root
+const DefaultZapperFixturesDir = "fixtures/zapper"
+
+// ZapperTransport sends a GraphQL request to Zapper and returns the raw
+// response body
+type ZapperTransport interface {
+	Do(ctx context.Context, request GraphQLRequest) ([]byte, error)
+}
+
+// zapperTransportFunc adapts a function to the ZapperTransport interface
+type zapperTransportFunc func(ctx context.Context, request GraphQLRequest) ([]byte, error)
+
+func (f zapperTransportFunc) Do(ctx context.Context, request GraphQLRequest) ([]byte, error) {
+	return f(ctx, request)
+}
+
+// FixtureTransport serves recorded portfolioV2 responses from disk instead
+// of calling Zapper
+type FixtureTransport struct {
+	dir string
+}
+
+// NewFixtureTransport creates a transport replaying fixtures from dir
+func NewFixtureTransport(dir string) *FixtureTransport {
+	return &FixtureTransport{dir: dir}
+}
+
+// Do implements ZapperTransport
+func (t *FixtureTransport) Do(ctx context.Context, request GraphQLRequest) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path, err := fixturePath(t.dir, request)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no Zapper fixture at %s (run with ZAPPER_MODE=record to capture it)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Zapper fixture: %w", err)
+	}
+
+	return body, nil
+}
+
+// RecordingTransport forwards requests to another transport and writes every
+// response to disk in the layout FixtureTransport reads
+type RecordingTransport struct {
+	dir  string
+	next ZapperTransport
+}
+
+// NewRecordingTransport creates a transport recording next's responses to dir
+func NewRecordingTransport(dir string, next ZapperTransport) *RecordingTransport {
+	return &RecordingTransport{dir: dir, next: next}
+}
+
+// Do implements ZapperTransport
+func (t *RecordingTransport) Do(ctx context.Context, request GraphQLRequest) ([]byte, error) {
+	body, err := t.next.Do(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := fixturePath(t.dir, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+
+	// Indent fixtures so recorded changes are reviewable in diffs
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		indented.Reset()
+		indented.Write(body)
+	}
+	if err := os.WriteFile(path, indented.Bytes(), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write Zapper fixture: %w", err)
+	}
+	log.Printf("Recorded Zapper fixture %s", path)
+
+	return body, nil
+}
+
+var operationNamePattern = regexp.MustCompile(`^\s*query\s+(\w+)`)
+
+// fixturePath maps a request to <dir>/<address>/<operation>-<hash>.json. The
+// hash covers every variable except the addresses, so each page, page size and
+// chain scope gets its own fixture.
+func fixturePath(dir string, request GraphQLRequest) (string, error) {
+	match := operationNamePattern.FindStringSubmatch(request.Query)
+	if match == nil {
+		return "", fmt.Errorf("fixture requests must use a named query")
+	}
+
+	addresses, ok := request.Variables["addresses"].([]string)
+	if !ok || len(addresses) == 0 {
+		return "", fmt.Errorf("fixture requests must have an addresses variable")
+	}
+
+	variables := make(map[string]interface{}, len(request.Variables))
+	for key, value := range request.Variables {
+		if key != "addresses" {
+			variables[key] = value
+		}
+	}
+	// encoding/json sorts map keys, which keeps the hash stable
+	encoded, err := json.Marshal(variables)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode fixture key: %w", err)
+	}
+	sum := sha256.Sum256(encoded)
+
+	wallet := strings.ToLower(strings.Join(addresses, "+"))
+	name := fmt.Sprintf("%s-%s.json", match[1], hex.EncodeToString(sum[:])[:12])
+	return filepath.Join(dir, wallet, name), nil
+}
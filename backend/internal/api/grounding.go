@@ -0,0 +1,24 @@
+package api
+
+// ResolvedToken is a recommended symbol resolved to a concrete contract
+type ResolvedToken struct {
+	Symbol   string `json:"symbol"`
+	Address  string `json:"address"`
+	ChainID  int    `json:"chain_id"`
+	Network  string `json:"network"`
+	Decimals int    `json:"decimals"`
+	// Source is where the token was resolved from: registry or portfolio
+	Source string `json:"source"`
+}
+
+// RejectedToken is a recommended symbol that could not be grounded
+type RejectedToken struct {
+	Symbol string `json:"symbol"`
+	Reason string `json:"reason"`
+}
+
+// Grounder checks an engine's token recommendations against known tokens on
+// the wallet's networks, resolving the ones it can and rejecting the rest
+type Grounder interface {
+	Ground(req RiskRequest, resp *RiskResponse)
+}
@@ -1,24 +1,71 @@
 package api
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"strconv"
+	"time"
 
-	"github.com/google/uuid"
+	"dex-analyzer/internal/address"
 )
 
 type Server struct {
-	// No dependencies needed for position fetching
+	portfolio     PortfolioProvider
+	engines       map[string]RiskEngine
+	defaultEngine string
+	factors       FactorAnalyzer
+	grounder      Grounder
+	snapshots     SnapshotStore
+	resolver      NameResolver
+	prompts       PromptValidator
+	cache         *portfolioCache
+
+	divergenceThreshold float64
+	batchConcurrency    int
+	maxBatchSize        int
+}
+
+// Config holds the dependencies injected into a Server
+type Config struct {
+	// Portfolio loads wallet balances for the requested address
+	Portfolio PortfolioProvider
+	// Engines maps engine names accepted by ?engine= to their implementations
+	Engines map[string]RiskEngine
+	// DefaultEngine is used when a request does not select an engine
+	DefaultEngine string
+	// Factors, when set, attaches a per-factor breakdown to responses from
+	// engines that do not produce one themselves
+	Factors FactorAnalyzer
+	// Grounder, when set, resolves recommended tokens to concrete contracts
+	// and rejects symbols that cannot be grounded
+	Grounder Grounder
+	// Snapshots, when set, persists every analysis and serves wallet history
+	Snapshots SnapshotStore
+	// Resolver, when set, lets /analyze and /positions take ENS names and
+	// Basenames instead of addresses
+	Resolver NameResolver
+	// Prompts, when set, rejects unknown risk_profile and prompt values up
+	// front instead of when an LLM engine builds its prompt
+	Prompts PromptValidator
+	// CacheTTL is how long fetched portfolios are reused by later requests
+	// for the same address and chains; caching is disabled when zero
+	CacheTTL time.Duration
+	// DivergenceThreshold is the ensemble score spread flagged as a sharp
+	// disagreement; DefaultDivergenceThreshold is used when zero
+	DivergenceThreshold float64
+	// BatchConcurrency is how many wallets of a batch are analyzed at once;
+	// DefaultBatchConcurrency is used when zero
+	BatchConcurrency int
+	// MaxBatchSize caps the addresses of a batch; DefaultMaxBatchSize is used
+	// when zero
+	MaxBatchSize int
 }
 
 // Simple response structure for positions
 type PositionsResponse struct {
-	Address   string            `json:"address"`
+	Address string `json:"address"`
+	// Name is the ENS name or Basename the address was resolved from
+	Name      string            `json:"name,omitempty"`
 	Positions []GraphQLPosition `json:"positions"`
 }
 
@@ -63,39 +110,108 @@ type GraphQLPosition struct {
 	} `json:"pool"`
 }
 
-func NewServer() *Server {
-	return &Server{}
+// NewServer creates a Server from the given configuration
+func NewServer(cfg Config) (*Server, error) {
+	if cfg.Portfolio == nil {
+		return nil, fmt.Errorf("portfolio provider is required")
+	}
+	if _, ok := cfg.Engines[cfg.DefaultEngine]; !ok {
+		return nil, fmt.Errorf("default risk engine %q is not registered", cfg.DefaultEngine)
+	}
+
+	divergenceThreshold := cfg.DivergenceThreshold
+	if divergenceThreshold <= 0 {
+		divergenceThreshold = DefaultDivergenceThreshold
+	}
+
+	batchConcurrency := cfg.BatchConcurrency
+	if batchConcurrency <= 0 {
+		batchConcurrency = DefaultBatchConcurrency
+	}
+	maxBatchSize := cfg.MaxBatchSize
+	if maxBatchSize <= 0 {
+		maxBatchSize = DefaultMaxBatchSize
+	}
+
+	var cache *portfolioCache
+	if cfg.CacheTTL > 0 {
+		cache = newPortfolioCache(cfg.Portfolio, cfg.CacheTTL)
+	}
+
+	return &Server{
+		portfolio:           cfg.Portfolio,
+		engines:             cfg.Engines,
+		defaultEngine:       cfg.DefaultEngine,
+		factors:             cfg.Factors,
+		grounder:            cfg.Grounder,
+		snapshots:           cfg.Snapshots,
+		resolver:            cfg.Resolver,
+		prompts:             cfg.Prompts,
+		cache:               cache,
+		divergenceThreshold: divergenceThreshold,
+		batchConcurrency:    batchConcurrency,
+		maxBatchSize:        maxBatchSize,
+	}, nil
 }
 
-// AnalyzeRequest is the request payload for the /analyze endpoint
+// AnalysisOptions are the analysis settings shared by POST /analyze and POST
+// /analyze/batch. GET /analyze takes them as query parameters of the same
+// names.
+type AnalysisOptions struct {
+	// Engine names one engine, or several for an ensemble analysis; the
+	// default engine is used when empty
+	Engine StringList `json:"engine,omitempty"`
+	// Chains scopes the portfolio to chain IDs or slugs; every supported
+	// chain is queried when empty
+	Chains        StringList `json:"chains,omitempty"`
+	RiskProfile   string     `json:"risk_profile,omitempty"`
+	PromptVersion string     `json:"prompt,omitempty"`
+	// MinUSD drops wallet tokens and app positions worth less than this many
+	// dollars before the portfolio is scored
+	MinUSD float64 `json:"min_usd,omitempty"`
+	// IncludeTokenBalances and IncludeAppBalances return the scored balances
+	// with the analysis; both default to true
+	IncludeTokenBalances *bool `json:"include_token_balances,omitempty"`
+	IncludeAppBalances   *bool `json:"include_app_balances,omitempty"`
+}
+
+// AnalyzeRequest is the body of POST /analyze
 type AnalyzeRequest struct {
+	// Address is a 0x address, ENS name or Basename
 	Address string `json:"address"`
+	AnalysisOptions
 }
 
-// AnalyzeResponse is the simplified ASI:One analysis response we return
-type AnalyzeResponse struct {
-	Address         string `json:"address"`
-	Recommendations string `json:"recommendations"`
+// AnalyzeResponse is the body returned by GET and POST /analyze
+type AnalyzeResponse = RiskResponse
+
+// parseAddress validates a wallet address and returns its canonical form
+func parseAddress(value string) (string, error) {
+	canonical, err := address.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidAddress, err)
+	}
+	return canonical, nil
 }
 
 func (s *Server) GetPositions(w http.ResponseWriter, r *http.Request) {
-	// Parse Ethereum address from query parameters
-	address := r.URL.Query().Get("address")
-	if address == "" {
-		http.Error(w, "address parameter is required", http.StatusBadRequest)
+	chainIDs, err := ParseChains(r.URL.Query().Get("chains"))
+	if err != nil {
+		writeError(w, r, invalidRequest(err))
 		return
 	}
 
-	// Validate Ethereum address format (basic validation)
-	if len(address) != 42 || address[:2] != "0x" {
-		http.Error(w, "invalid Ethereum address format", http.StatusBadRequest)
+	// Validate or resolve the address and use its canonical form from here on
+	wallet, name, err := s.resolveWallet(r.Context(), r.URL.Query().Get("address"))
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	// Fetch portfolio data from Zapper API
-	riskRequest, err := s.fetchPortfolioFromZapper(address)
+	// Fetch portfolio data from the configured provider
+	riskRequest, err := s.fetchPortfolio(w, r, wallet, chainIDs)
 	if err != nil {
-		http.Error(w, "failed to fetch portfolio data: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -108,7 +224,7 @@ func (s *Server) GetPositions(w http.ResponseWriter, r *http.Request) {
 			if len(contractPos.Tokens) >= 2 {
 				pos := GraphQLPosition{
 					ID:    contractPos.Address,
-					Owner: address,
+					Owner: wallet,
 					Pool: struct {
 						ID     string `json:"id"`
 						Token0 struct {
@@ -152,7 +268,8 @@ func (s *Server) GetPositions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := PositionsResponse{
-		Address:   address,
+		Address:   wallet,
+		Name:      name,
 		Positions: positions,
 	}
 
@@ -160,694 +277,11 @@ func (s *Server) GetPositions(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// fetchPortfolioFromZapper calls Zapper API to fetch portfolio data
-func (s *Server) fetchPortfolioFromZapper(address string) (*RiskRequest, error) {
-	// Fetch token balances
-	tokenBalances, err := s.fetchTokenBalances(address)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch token balances: %w", err)
-	}
-
-	// Fetch app balances
-	appBalances, err := s.fetchAppBalances(address)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch app balances: %w", err)
-	}
-
-	// Combine both responses into RiskRequest
-	riskRequest := &RiskRequest{
-		Address:       address,
-		TokenBalances: *tokenBalances,
-		AppBalances:   *appBalances,
-	}
-
-	return riskRequest, nil
-}
-
-// fetchTokenBalances fetches token balances using the exact curl query
-func (s *Server) fetchTokenBalances(address string) (*TokenBalances, error) {
-	query := `query TokenBalances($addresses: [Address!]!) {
-		portfolioV2(addresses: $addresses) {
-			tokenBalances {
-				totalBalanceUSD
-				byToken {
-					totalCount
-					edges {
-						node {
-							name
-							symbol
-							price
-							tokenAddress
-							imgUrlV2
-							decimals
-							balanceRaw
-							balance
-							balanceUSD
-							onchainMarketData {
-								priceChange24h
-								marketCap
-							}
-						}
-					}
-				}
-			}
-		}
-	}`
-
-	request := GraphQLRequest{
-		Query: query,
-		Variables: map[string]interface{}{
-			"addresses": []string{address},
-		},
-	}
-
-	body, err := s.makeZapperRequest(request)
-	if err != nil {
-		return nil, err
-	}
-
-	tokenBalances, err := s.parseTokenBalancesResponse(address, body)
-	if err != nil {
-		return nil, err
-	}
-
-	return tokenBalances, nil
-}
-
-// fetchAppBalances fetches app balances using the exact curl query
-func (s *Server) fetchAppBalances(address string) (*AppBalances, error) {
-	query := `query AppBalances($addresses: [Address!]!) {
-		portfolioV2(addresses: $addresses) {
-			appBalances {
-				totalBalanceUSD
-				byApp {
-					totalCount
-					edges {
-						node {
-							balanceUSD
-							app {
-								displayName
-								imgUrl
-								description
-								category {
-									name
-								}
-							}
-							network {
-								name
-								chainId
-							}
-							positionBalances {
-								edges {
-									node {
-										... on AppTokenPositionBalance {
-											type
-											symbol
-											balance
-											balanceUSD
-											price
-											groupLabel
-											displayProps {
-												label
-												images
-											}
-										}
-										... on ContractPositionBalance {
-											type
-											balanceUSD
-											groupLabel
-											tokens {
-												metaType
-												token {
-													... on BaseTokenPositionBalance {
-														symbol
-														balance
-														balanceUSD
-													}
-												}
-											}
-											displayProps {
-												label
-												images
-											}
-										}
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}`
-
-	request := GraphQLRequest{
-		Query: query,
-		Variables: map[string]interface{}{
-			"addresses": []string{address},
-			"first":     5,
-		},
-	}
-
-	body, err := s.makeZapperRequest(request)
-	if err != nil {
-		return nil, err
-	}
-
-	appBalances, err := s.parseAppBalancesResponse(address, body)
-	if err != nil {
-		return nil, err
-	}
-
-	return appBalances, nil
-}
-
-// makeZapperRequest makes a request to Zapper API with the provided query
-func (s *Server) makeZapperRequest(request GraphQLRequest) ([]byte, error) {
-	// Marshal request to JSON
-	requestBody, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal Zapper request: %w", err)
-	}
-
-	// Create HTTP request to Zapper API
-	req, err := http.NewRequest("POST", "https://public.zapper.xyz/graphql", bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-
-	// Get Zapper API key from environment variable
-	apiKey := os.Getenv("ZAPPER_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("ZAPPER_API_KEY environment variable is not set")
-	}
-	req.Header.Set("x-zapper-api-key", apiKey)
-
-	// Make HTTP request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make HTTP request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	return body, nil
-}
-
-// parseTokenBalancesResponse parses the token balances response
-func (s *Server) parseTokenBalancesResponse(address string, responseBody []byte) (*TokenBalances, error) {
-	// Print the raw JSON response before parsing
-	fmt.Printf("Raw Token Balances Response for address %s:\n", address)
-	fmt.Printf("%s\n\n", string(responseBody))
-
-	var resp struct {
-		Data struct {
-			PortfolioV2 struct {
-				TokenBalances struct {
-					TotalBalanceUSD float64 `json:"totalBalanceUSD"`
-					ByToken         struct {
-						Edges []struct {
-							Node struct {
-								Name              string  `json:"name"`
-								Symbol            string  `json:"symbol"`
-								Price             float64 `json:"price"`
-								TokenAddress      string  `json:"tokenAddress"`
-								ImgURLV2          *string `json:"imgUrlV2"`
-								Decimals          float64 `json:"decimals"`
-								BalanceRaw        string  `json:"balanceRaw"`
-								Balance           float64 `json:"balance"`
-								BalanceUSD        float64 `json:"balanceUSD"`
-								OnchainMarketData *struct {
-									PriceChange24h *float64 `json:"priceChange24h"`
-									MarketCap      *float64 `json:"marketCap"`
-								} `json:"onchainMarketData"`
-							} `json:"node"`
-						} `json:"edges"`
-					} `json:"byToken"`
-				} `json:"tokenBalances"`
-			} `json:"portfolioV2"`
-		} `json:"data"`
-		Errors []struct {
-			Message string `json:"message"`
-		} `json:"errors,omitempty"`
-	}
-
-	if err := json.Unmarshal(responseBody, &resp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal token balances response: %w", err)
-	}
-
-	if len(resp.Errors) > 0 {
-		return nil, fmt.Errorf("token balances API errors: %v", resp.Errors)
-	}
-
-	// Convert to our TokenBalances structure
-	tokenBalances := make([]TokenBalance, 0)
-	for _, edge := range resp.Data.PortfolioV2.TokenBalances.ByToken.Edges {
-		node := edge.Node
-		tokenBalance := TokenBalance{
-			TokenAddress: node.TokenAddress,
-			Symbol:       node.Symbol,
-			Name:         node.Name,
-			Decimals:     node.Decimals,
-			Price:        node.Price,
-			Balance:      node.Balance,
-			BalanceUSD:   node.BalanceUSD,
-			BalanceRaw:   node.BalanceRaw,
-			Network: Network{
-				Name: "Base", // Since we're using chainIds: [8453]
-				Slug: "base",
-			},
-			ImgURLV2: node.ImgURLV2,
-		}
-		tokenBalances = append(tokenBalances, tokenBalance)
-	}
-
-	return &TokenBalances{
-		TotalBalanceUSD: resp.Data.PortfolioV2.TokenBalances.TotalBalanceUSD,
-		ByToken:         tokenBalances,
-	}, nil
-}
-
-// parseAppBalancesResponse parses the app balances response
-func (s *Server) parseAppBalancesResponse(address string, responseBody []byte) (*AppBalances, error) {
-	// Print the raw JSON response before parsing
-	fmt.Printf("Raw App Balances Response for address %s:\n", address)
-	fmt.Printf("%s\n\n", string(responseBody))
-
-	var resp struct {
-		Data struct {
-			PortfolioV2 struct {
-				AppBalances struct {
-					ByApp struct {
-						Edges []struct {
-							Node struct {
-								BalanceUSD float64 `json:"balanceUSD"`
-								App        struct {
-									DisplayName string `json:"displayName"`
-									ImgURL      string `json:"imgUrl"`
-									Description string `json:"description"`
-									Category    struct {
-										Name string `json:"name"`
-									} `json:"category"`
-								} `json:"app"`
-								Network struct {
-									Name    string `json:"name"`
-									ChainID int    `json:"chainId"`
-								} `json:"network"`
-								PositionBalances struct {
-									Edges []struct {
-										Node struct {
-											Type       string   `json:"type"`
-											Symbol     *string  `json:"symbol"`
-											Balance    *string  `json:"balance"` // Can be string or number
-											BalanceUSD float64  `json:"balanceUSD"`
-											Price      *float64 `json:"price"`      // Changed back to float64 as it's a number in response
-											GroupLabel *string  `json:"groupLabel"` // Can be null
-											Tokens     *[]struct {
-												MetaType string `json:"metaType"`
-												Token    struct {
-													Symbol     string `json:"symbol"`
-													Balance    string `json:"balance"`    // String in response
-													BalanceUSD string `json:"balanceUSD"` // String in response
-												} `json:"symbol"`
-											} `json:"tokens"`
-											DisplayProps struct {
-												Label  string   `json:"label"`
-												Images []string `json:"images"`
-											} `json:"displayProps"`
-										} `json:"node"`
-									} `json:"edges"`
-								} `json:"positionBalances"`
-							} `json:"node"`
-						} `json:"edges"`
-					} `json:"byApp"`
-				} `json:"appBalances"`
-			} `json:"portfolioV2"`
-		} `json:"data"`
-		Errors []struct {
-			Message string `json:"message"`
-		} `json:"errors,omitempty"`
-	}
-
-	if err := json.Unmarshal(responseBody, &resp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal app balances response: %w", err)
-	}
-
-	if len(resp.Errors) > 0 {
-		return nil, fmt.Errorf("app balances API errors: %v", resp.Errors)
-	}
-
-	// Convert to our AppBalances structure
-	appBalances := make([]AppBalance, 0)
-	for _, appEdge := range resp.Data.PortfolioV2.AppBalances.ByApp.Edges {
-		appNode := appEdge.Node
-
-		contractPositions := make([]ContractPosition, 0)
-		for _, posEdge := range appNode.PositionBalances.Edges {
-			posNode := posEdge.Node
-
-			tokenPositions := make([]TokenPosition, 0)
-			if posNode.Tokens != nil {
-				for _, token := range *posNode.Tokens {
-					// Parse string values to float64
-					balance, _ := strconv.ParseFloat(token.Token.Balance, 64)
-					balanceUSD, _ := strconv.ParseFloat(token.Token.BalanceUSD, 64)
-
-					tokenPos := TokenPosition{
-						MetaType: token.MetaType,
-						Token: TokenBalance{
-							Symbol:     token.Token.Symbol,
-							Balance:    balance,
-							BalanceUSD: balanceUSD,
-							// Fill in other required fields with defaults
-							TokenAddress: "unknown",
-							Name:         token.Token.Symbol,
-							Decimals:     18,
-							Price:        0,
-							BalanceRaw:   token.Token.Balance, // Use the original string value
-							Network: Network{
-								Name: appNode.Network.Name,
-								Slug: "base", // Default to base
-							},
-						},
-					}
-					tokenPositions = append(tokenPositions, tokenPos)
-				}
-			}
-
-			// Handle nullable GroupLabel
-			address := "unknown"
-			if posNode.GroupLabel != nil {
-				address = *posNode.GroupLabel
-			}
-
-			contractPos := ContractPosition{
-				Address:    address,
-				BalanceUSD: posNode.BalanceUSD,
-				Tokens:     tokenPositions,
-				DisplayProps: DisplayProps{
-					Label:  posNode.DisplayProps.Label,
-					Images: posNode.DisplayProps.Images,
-				},
-			}
-			contractPositions = append(contractPositions, contractPos)
-		}
-
-		appBalance := AppBalance{
-			App: App{
-				DisplayName: appNode.App.DisplayName,
-				Slug:        appNode.App.Category.Name, // Use category as slug
-			},
-			Network: Network{
-				Name: appNode.Network.Name,
-				Slug: "base", // Default to base
-			},
-			Balances: contractPositions,
-		}
-		appBalances = append(appBalances, appBalance)
-	}
-
-	return &AppBalances{
-		ByApp: appBalances,
-	}, nil
-}
-
-// Zapper GraphQL response structures
-type ZapperTokenNode struct {
-	Symbol       string  `json:"symbol"`
-	TokenAddress string  `json:"tokenAddress"`
-	Balance      float64 `json:"balance"`
-	BalanceUSD   float64 `json:"balanceUSD"`
-	Price        float64 `json:"price"`
-	ImgURLV2     *string `json:"imgUrlV2"`
-	Name         string  `json:"name"`
-	Decimals     float64 `json:"decimals"`
-	BalanceRaw   string  `json:"balanceRaw"`
-	Network      struct {
-		Name string `json:"name"`
-		Slug string `json:"slug"`
-	} `json:"network"`
-}
-
-type ZapperTokenEdge struct {
-	Node ZapperTokenNode `json:"node"`
-}
-
-type ZapperTokenConnection struct {
-	Edges []ZapperTokenEdge `json:"edges"`
-}
-
-type ZapperTokenBalances struct {
-	TotalBalanceUSD float64               `json:"totalBalanceUSD"`
-	ByToken         ZapperTokenConnection `json:"byToken"`
-}
-
-type ZapperAppToken struct {
-	MetaType string `json:"metaType"`
-	Token    struct {
-		Symbol       string  `json:"symbol"`
-		TokenAddress string  `json:"tokenAddress"`
-		Balance      float64 `json:"balance"`
-		BalanceUSD   float64 `json:"balanceUSD"`
-		Price        float64 `json:"price"`
-		ImgURLV2     *string `json:"imgUrlV2"`
-		Name         string  `json:"name"`
-		Decimals     float64 `json:"decimals"`
-		BalanceRaw   string  `json:"balanceRaw"`
-		Network      struct {
-			Name string `json:"name"`
-			Slug string `json:"slug"`
-		} `json:"network"`
-	} `json:"token"`
-}
-
-type ZapperContractNode struct {
-	Address      string           `json:"address"`
-	BalanceUSD   float64          `json:"balanceUSD"`
-	Tokens       []ZapperAppToken `json:"tokens"`
-	DisplayProps struct {
-		Label  string   `json:"label"`
-		Images []string `json:"images"`
-	} `json:"displayProps"`
-}
-
-type ZapperContractEdge struct {
-	Node ZapperContractNode `json:"node"`
-}
-
-type ZapperContractConnection struct {
-	Edges []ZapperContractEdge `json:"edges"`
-}
-
-type ZapperAppNode struct {
-	App struct {
-		DisplayName string `json:"displayName"`
-		Slug        string `json:"slug"`
-	} `json:"app"`
-	Network struct {
-		Name string `json:"name"`
-		Slug string `json:"slug"`
-	} `json:"network"`
-	Balances ZapperContractConnection `json:"balances"`
-}
-
-type ZapperAppEdge struct {
-	Node ZapperAppNode `json:"node"`
-}
-
-type ZapperAppConnection struct {
-	Edges []ZapperAppEdge `json:"edges"`
-}
-
-type ZapperAppBalances struct {
-	ByApp ZapperAppConnection `json:"byApp"`
-}
-
-type ZapperPortfolioV2 struct {
-	TokenBalances ZapperTokenBalances `json:"tokenBalances"`
-	AppBalances   ZapperAppBalances   `json:"appBalances"`
-}
-
-type ZapperResponse struct {
-	Data struct {
-		PortfolioV2 ZapperPortfolioV2 `json:"portfolioV2"`
-	} `json:"data"`
-	Errors []struct {
-		Message string `json:"message"`
-	} `json:"errors,omitempty"`
-}
-
-// parseZapperResponse converts Zapper API response to RiskRequest format
-func (s *Server) parseZapperResponse(address string, responseBody []byte) (*RiskRequest, error) {
-	// Print the raw JSON response before parsing
-	fmt.Printf("Raw Zapper API Response for address %s:\n", address)
-	fmt.Printf("%s\n\n", string(responseBody))
-
-	var zapperResp ZapperResponse
-	if err := json.Unmarshal(responseBody, &zapperResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal Zapper response: %w", err)
-	}
-
-	// Check for errors
-	if len(zapperResp.Errors) > 0 {
-		return nil, fmt.Errorf("Zapper API errors: %v", zapperResp.Errors)
-	}
-
-	portfolio := zapperResp.Data.PortfolioV2
-
-	// Convert token balances
-	tokenBalances := make([]TokenBalance, 0)
-	for _, edge := range portfolio.TokenBalances.ByToken.Edges {
-		node := edge.Node
-		tokenBalance := TokenBalance{
-			TokenAddress: node.TokenAddress,
-			Symbol:       node.Symbol,
-			Name:         node.Name,
-			Decimals:     node.Decimals,
-			Price:        node.Price,
-			Balance:      node.Balance,
-			BalanceUSD:   node.BalanceUSD,
-			BalanceRaw:   node.BalanceRaw,
-			Network: Network{
-				Name: node.Network.Name,
-				Slug: node.Network.Slug,
-			},
-			ImgURLV2: node.ImgURLV2,
-		}
-		tokenBalances = append(tokenBalances, tokenBalance)
-	}
-
-	// Convert app balances
-	appBalances := make([]AppBalance, 0)
-	for _, appEdge := range portfolio.AppBalances.ByApp.Edges {
-		appNode := appEdge.Node
-
-		contractPositions := make([]ContractPosition, 0)
-		for _, contractEdge := range appNode.Balances.Edges {
-			contractNode := contractEdge.Node
-
-			tokenPositions := make([]TokenPosition, 0)
-			for _, appToken := range contractNode.Tokens {
-				tokenPos := TokenPosition{
-					MetaType: appToken.MetaType,
-					Token: TokenBalance{
-						TokenAddress: appToken.Token.TokenAddress,
-						Symbol:       appToken.Token.Symbol,
-						Name:         appToken.Token.Name,
-						Decimals:     appToken.Token.Decimals,
-						Price:        appToken.Token.Price,
-						Balance:      appToken.Token.Balance,
-						BalanceUSD:   appToken.Token.BalanceUSD,
-						BalanceRaw:   appToken.Token.BalanceRaw,
-						Network: Network{
-							Name: appToken.Token.Network.Name,
-							Slug: appToken.Token.Network.Slug,
-						},
-						ImgURLV2: appToken.Token.ImgURLV2,
-					},
-				}
-				tokenPositions = append(tokenPositions, tokenPos)
-			}
-
-			contractPos := ContractPosition{
-				Address:    contractNode.Address,
-				BalanceUSD: contractNode.BalanceUSD,
-				Tokens:     tokenPositions,
-				DisplayProps: DisplayProps{
-					Label:  contractNode.DisplayProps.Label,
-					Images: contractNode.DisplayProps.Images,
-				},
-			}
-			contractPositions = append(contractPositions, contractPos)
-		}
-
-		appBalance := AppBalance{
-			App: App{
-				DisplayName: appNode.App.DisplayName,
-				Slug:        appNode.App.Slug,
-			},
-			Network: Network{
-				Name: appNode.Network.Name,
-				Slug: appNode.Network.Slug,
-			},
-			Balances: contractPositions,
-		}
-		appBalances = append(appBalances, appBalance)
-	}
-
-	riskRequest := &RiskRequest{
-		Address: address,
-		TokenBalances: TokenBalances{
-			TotalBalanceUSD: portfolio.TokenBalances.TotalBalanceUSD,
-			ByToken:         tokenBalances,
-		},
-		AppBalances: AppBalances{
-			ByApp: appBalances,
-		},
-	}
-
-	return riskRequest, nil
-}
-
-// callRiskAdvisorAPI calls the risk advisor API with the given risk request
-func (s *Server) callRiskAdvisorAPI(riskRequest RiskRequest) (*RiskResponse, error) {
-	// Marshal the risk request to JSON
-	requestBody, err := json.Marshal(riskRequest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal risk request: %w", err)
-	}
-
-	// Create HTTP request to the risk advisor API
-	req, err := http.NewRequest("POST", "http://localhost:8000/api/analyze", bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-
-	// Make HTTP request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make HTTP request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("risk advisor API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	// Parse response
-	var riskResponse RiskResponse
-	if err := json.Unmarshal(body, &riskResponse); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal risk response: %w", err)
-	}
-
-	return &riskResponse, nil
-}
-
 // Zapper API and Risk Advisor types
 type Network struct {
-	Name string `json:"name"`
-	Slug string `json:"slug"`
+	Name    string `json:"name"`
+	Slug    string `json:"slug"`
+	ChainID int    `json:"chain_id,omitempty"`
 }
 
 type TokenBalance struct {
@@ -865,6 +299,8 @@ type TokenBalance struct {
 
 type TokenBalances struct {
 	TotalBalanceUSD float64        `json:"total_balance_usd"`
+	TotalCount      int            `json:"total_count,omitempty"`
+	Truncated       bool           `json:"truncated,omitempty"`
 	ByToken         []TokenBalance `json:"by_token"`
 }
 
@@ -897,162 +333,59 @@ type AppBalance struct {
 }
 
 type AppBalances struct {
-	ByApp []AppBalance `json:"by_app"`
+	TotalBalanceUSD float64      `json:"total_balance_usd,omitempty"`
+	TotalCount      int          `json:"total_count,omitempty"`
+	Truncated       bool         `json:"truncated,omitempty"`
+	ByApp           []AppBalance `json:"by_app"`
 }
 
 type RiskRequest struct {
 	Address       string        `json:"address"`
 	TokenBalances TokenBalances `json:"token_balances"`
 	AppBalances   AppBalances   `json:"app_balances"`
+	// RiskProfile and PromptVersion select the LLM prompt variables and
+	// template; empty values use the prompt builder's defaults
+	RiskProfile   string `json:"-"`
+	PromptVersion string `json:"-"`
 }
 
 type RiskResponse struct {
-	RecommendedTokens []string      `json:"recommended_tokens"`
-	RiskScore         float64       `json:"risk_score"`
-	Reasoning         []string      `json:"reasoning"`
-	TokenBalances     TokenBalances `json:"token_balances"`
-	AppBalances       AppBalances   `json:"app_balances"`
-}
-
-func (s *Server) callASI1(riskRequest RiskRequest) (*RiskResponse, error) {
-	reqJSON, err := json.Marshal(riskRequest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal riskRequest: %w", err)
-	}
-
-	userContent := fmt.Sprintf(
-		`Analyze the following portfolio JSON and return recommendations using the tool schema provided: %s`,
-		string(reqJSON),
-	)
-
-	bodyObj := map[string]interface{}{
-		"model": "asi1-mini",
-		"messages": []map[string]string{
-			{"role": "user", "content": userContent},
-		},
-		"tools": []map[string]interface{}{
-			{
-				"type": "function",
-				"function": map[string]interface{}{
-					"name":        "analyze_portfolio_risk",
-					"description": "Analyze a user's DeFi portfolio and recommend risk-aware actions.",
-					"parameters": map[string]interface{}{
-						"type": "object",
-						"properties": map[string]interface{}{
-							"recommended_tokens": map[string]interface{}{
-								"type":        "array",
-								"items":       map[string]string{"type": "string"},
-								"description": "List of token symbols recommended for the user to hold or accumulate.",
-							},
-							"risk_score": map[string]interface{}{
-								"type":        "number",
-								"description": "Portfolio risk score from 0 (safe) to 1 (high risk).",
-							},
-							"reasoning": map[string]interface{}{
-								"type":        "array",
-								"items":       map[string]string{"type": "string"},
-								"description": "Explanations for the risk score and token recommendations.",
-							},
-						},
-						"required": []string{"recommended_tokens", "risk_score", "reasoning"},
-					},
-				},
-			},
-		},
-	}
-
-	bodyBytes, err := json.Marshal(bodyObj)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal ASI1 request: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", "https://api.asi1.ai/v1/chat/completions", bytes.NewBuffer(bodyBytes))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	apiKey := os.Getenv("ASI_ONE_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("ASI_ONE_API_KEY not set")
-	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	sessionID := uuid.NewString()
-	req.Header.Set("x-session-id", sessionID)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("ASI1 request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ASI1 error %d: %s", resp.StatusCode, string(respBytes))
-	}
-
-	// Parse ASI1 response
-	var asiResp struct {
-		Choices []struct {
-			Message struct {
-				ToolCalls []struct {
-					Function struct {
-						Name      string `json:"name"`
-						Arguments string `json:"arguments"` // <-- now as string
-					} `json:"function"`
-				} `json:"tool_calls"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-
-	if err := json.Unmarshal(respBytes, &asiResp); err != nil {
-		return nil, fmt.Errorf("unmarshal ASI1 response failed: %w", err)
-	}
-
-	if len(asiResp.Choices) == 0 || len(asiResp.Choices[0].Message.ToolCalls) == 0 {
-		return nil, fmt.Errorf("ASI1 did not return tool call")
-	}
-
-	argsStr := asiResp.Choices[0].Message.ToolCalls[0].Function.Arguments
-
-	var riskResp RiskResponse
-	if err := json.Unmarshal([]byte(argsStr), &riskResp); err != nil {
-		return nil, fmt.Errorf("failed to parse tool call arguments: %w; raw=%s", err, argsStr)
-	}
-
-	return &riskResp, nil
-}
-
+	// Address is the analyzed wallet and Name the ENS name or Basename it
+	// was resolved from
+	Address           string          `json:"address,omitempty"`
+	Name              string          `json:"name,omitempty"`
+	Engine            string          `json:"engine,omitempty"`
+	Path              string          `json:"path,omitempty"`
+	Attempts          int             `json:"attempts,omitempty"`
+	PromptVersion     string          `json:"prompt_version,omitempty"`
+	PromptTokens      int             `json:"prompt_tokens,omitempty"`
+	SnapshotID        string          `json:"snapshot_id,omitempty"`
+	RecommendedTokens []string        `json:"recommended_tokens"`
+	ResolvedTokens    []ResolvedToken `json:"resolved_tokens,omitempty"`
+	RejectedTokens    []RejectedToken `json:"rejected_tokens,omitempty"`
+	RiskScore         float64         `json:"risk_score"`
+	Reasoning         []string        `json:"reasoning"`
+	Factors           []RiskFactor    `json:"factors,omitempty"`
+	// FactorsSource tells whether Factors came from the engine itself or
+	// from the deterministic rules
+	FactorsSource string          `json:"factors_source,omitempty"`
+	Ensemble      *EnsembleResult `json:"ensemble,omitempty"`
+	Chains        []ChainSubtotal `json:"chains,omitempty"`
+	// Truncated is set when the portfolio exceeded the fetch cap and was
+	// scored on partial data
+	Truncated bool `json:"truncated"`
+	// TokenBalances and AppBalances are the scored portfolio, omitted when
+	// the request opts out of them
+	TokenBalances *TokenBalances `json:"token_balances,omitempty"`
+	AppBalances   *AppBalances   `json:"app_balances,omitempty"`
+}
+
+// AnalyzeWithASI handles GET /analyze
 func (s *Server) AnalyzeWithASI(w http.ResponseWriter, r *http.Request) {
-	address := r.URL.Query().Get("address")
-	if address == "" {
-		http.Error(w, "address parameter is required", http.StatusBadRequest)
-		return
-	}
-	if len(address) != 42 || address[:2] != "0x" {
-		http.Error(w, "invalid Ethereum address format", http.StatusBadRequest)
-		return
-	}
-
-	riskRequest, err := s.fetchPortfolioFromZapper(address)
+	req, err := analyzeRequestFromQuery(r.URL.Query())
 	if err != nil {
-		http.Error(w, "failed to fetch portfolio data: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-
-	riskResponse, err := s.callASI1(*riskRequest)
-	if err != nil {
-		http.Error(w, "failed to call ASI1: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	riskResponse.AppBalances = riskRequest.AppBalances
-	riskResponse.TokenBalances = riskRequest.TokenBalances
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(riskResponse)
+	s.analyzeWallet(w, r, req)
 }
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"dex-analyzer/internal/upstream"
+)
+
+// Tool-calling conventions understood by OpenAIClient
+const (
+	// ToolFormatTools sends tools/tool_choice and reads message.tool_calls
+	ToolFormatTools = "tools"
+	// ToolFormatFunctions sends the legacy functions/function_call fields
+	// for servers that predate tool calling
+	ToolFormatFunctions = "functions"
+)
+
+// Tool choices understood by OpenAIClient
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceRequired = "required"
+	ToolChoiceNone     = "none"
+	// ToolChoiceFunction forces a call to the first declared tool by name
+	ToolChoiceFunction = "function"
+)
+
+// Chat message roles
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleTool answers a tool call; it is sent as a function message in the
+	// functions tool format
+	RoleTool = "tool"
+)
+
+// ChatMessage is one message of a chat completion conversation
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolCall is the call made by an assistant message, or the call a tool
+	// message answers
+	ToolCall *ToolCall `json:"-"`
+}
+
+// Tool declares a function the model may call
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+}
+
+// ToolCall is the first tool call of a chat completion
+type ToolCall struct {
+	// ID identifies the call in the conversation; one is generated when the
+	// server sends none
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// LLMClient sends chat completion requests to a language model
+type LLMClient interface {
+	// Complete returns the first tool call of the model's answer, or nil when
+	// the model answered without calling a tool
+	Complete(ctx context.Context, messages []ChatMessage, tools []Tool) (*ToolCall, error)
+}
+
+// LLMConfig configures an OpenAIClient
+type LLMConfig struct {
+	// Name identifies the provider in logs and errors
+	Name string
+	// BaseURL is the API root that /chat/completions is appended to
+	BaseURL string
+	Model   string
+	APIKey  string
+	// RequireAPIKey fails every request when APIKey is empty; servers such as
+	// a local llama.cpp or vLLM instance usually run without a key
+	RequireAPIKey bool
+	// AuthHeader carries the API key; the default Authorization header is
+	// sent as "Bearer <key>"
+	AuthHeader string
+	// AuthScheme prefixes the key in a custom AuthHeader, e.g. "Token"; the
+	// key is sent bare when empty
+	AuthScheme string
+	// SessionHeader, when set, carries a fresh UUID on every request
+	SessionHeader string
+	// ToolFormat is ToolFormatTools (default) or ToolFormatFunctions
+	ToolFormat string
+	// ToolChoice is one of the ToolChoice values; the field is omitted from
+	// the request when empty
+	ToolChoice string
+	// HTTPClient sends the requests; a client with the upstream defaults is
+	// used when nil
+	HTTPClient *upstream.Client
+}
+
+// OpenAIClient is an LLMClient for OpenAI-compatible chat completion APIs
+type OpenAIClient struct {
+	name          string
+	endpoint      string
+	model         string
+	apiKey        string
+	requireAPIKey bool
+	authHeader    string
+	authScheme    string
+	sessionHeader string
+	toolFormat    string
+	toolChoice    string
+	client        *upstream.Client
+}
+
+// NewOpenAIClient creates a client for an OpenAI-compatible API
+func NewOpenAIClient(cfg LLMConfig) (*OpenAIClient, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("LLM base URL is required")
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = "LLM"
+	}
+
+	toolFormat := cfg.ToolFormat
+	if toolFormat == "" {
+		toolFormat = ToolFormatTools
+	}
+	if toolFormat != ToolFormatTools && toolFormat != ToolFormatFunctions {
+		return nil, fmt.Errorf("unknown tool format %q: expected %s or %s", toolFormat, ToolFormatTools, ToolFormatFunctions)
+	}
+
+	switch cfg.ToolChoice {
+	case "", ToolChoiceAuto, ToolChoiceRequired, ToolChoiceNone, ToolChoiceFunction:
+	default:
+		return nil, fmt.Errorf("unknown tool choice %q: expected auto, required, none or function", cfg.ToolChoice)
+	}
+
+	authHeader, authScheme := cfg.AuthHeader, cfg.AuthScheme
+	if authHeader == "" {
+		authHeader = "Authorization"
+		if authScheme == "" {
+			authScheme = "Bearer"
+		}
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = upstream.NewClient(upstream.Config{Name: name})
+	}
+
+	return &OpenAIClient{
+		name:          name,
+		endpoint:      strings.TrimRight(cfg.BaseURL, "/") + "/chat/completions",
+		model:         cfg.Model,
+		apiKey:        cfg.APIKey,
+		requireAPIKey: cfg.RequireAPIKey,
+		authHeader:    authHeader,
+		authScheme:    authScheme,
+		sessionHeader: cfg.SessionHeader,
+		toolFormat:    toolFormat,
+		toolChoice:    cfg.ToolChoice,
+		client:        client,
+	}, nil
+}
+
+// Complete sends one chat completion request. Failures are reported as an
+// UpstreamError of kind ErrUpstreamLLM.
+func (c *OpenAIClient) Complete(ctx context.Context, messages []ChatMessage, tools []Tool) (*ToolCall, error) {
+	call, err := c.complete(ctx, messages, tools)
+	if err != nil {
+		return nil, &UpstreamError{Upstream: strings.ToLower(c.name), Kind: ErrUpstreamLLM, Err: err}
+	}
+	return call, nil
+}
+
+func (c *OpenAIClient) complete(ctx context.Context, messages []ChatMessage, tools []Tool) (*ToolCall, error) {
+	if c.requireAPIKey && c.apiKey == "" {
+		return nil, fmt.Errorf("%s API key not set", c.name)
+	}
+
+	bodyBytes, err := json.Marshal(c.requestBody(messages, tools))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s request: %w", c.name, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		value := c.apiKey
+		if c.authScheme != "" {
+			value = c.authScheme + " " + c.apiKey
+		}
+		req.Header.Set(c.authHeader, value)
+	}
+	if c.sessionHeader != "" {
+		req.Header.Set(c.sessionHeader, uuid.NewString())
+	}
+
+	respBytes, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.parseResponse(respBytes)
+}
+
+// requestBody builds the chat completion request in the configured tool
+// format
+func (c *OpenAIClient) requestBody(messages []ChatMessage, tools []Tool) map[string]interface{} {
+	body := map[string]interface{}{
+		"messages": c.wireMessages(messages),
+	}
+	if c.model != "" {
+		body["model"] = c.model
+	}
+	if len(tools) == 0 {
+		return body
+	}
+
+	functions := make([]map[string]interface{}, len(tools))
+	for i, tool := range tools {
+		functions[i] = map[string]interface{}{
+			"name":        tool.Name,
+			"description": tool.Description,
+			"parameters":  tool.Parameters,
+		}
+	}
+
+	if c.toolFormat == ToolFormatFunctions {
+		body["functions"] = functions
+		switch c.toolChoice {
+		case "":
+		case ToolChoiceFunction, ToolChoiceRequired:
+			// function_call has no "required"; forcing the tool is the closest match
+			body["function_call"] = map[string]string{"name": tools[0].Name}
+		default:
+			body["function_call"] = c.toolChoice
+		}
+		return body
+	}
+
+	declared := make([]map[string]interface{}, len(functions))
+	for i, function := range functions {
+		declared[i] = map[string]interface{}{"type": "function", "function": function}
+	}
+	body["tools"] = declared
+	switch c.toolChoice {
+	case "":
+	case ToolChoiceFunction:
+		body["tool_choice"] = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": tools[0].Name},
+		}
+	default:
+		body["tool_choice"] = c.toolChoice
+	}
+	return body
+}
+
+// wireMessages encodes the conversation in the configured tool format. Tool
+// calls are echoed as the assistant message that made them and answered with
+// a tool or function message.
+func (c *OpenAIClient) wireMessages(messages []ChatMessage) []map[string]interface{} {
+	wire := make([]map[string]interface{}, len(messages))
+	for i, message := range messages {
+		encoded := map[string]interface{}{"role": message.Role, "content": message.Content}
+		call := message.ToolCall
+		switch {
+		case call == nil:
+		case message.Role == RoleAssistant && c.toolFormat == ToolFormatFunctions:
+			encoded["content"] = nil
+			encoded["function_call"] = map[string]string{"name": call.Name, "arguments": call.Arguments}
+		case message.Role == RoleAssistant:
+			encoded["content"] = nil
+			encoded["tool_calls"] = []map[string]interface{}{{
+				"id":       call.ID,
+				"type":     "function",
+				"function": map[string]string{"name": call.Name, "arguments": call.Arguments},
+			}}
+		case message.Role == RoleTool && c.toolFormat == ToolFormatFunctions:
+			encoded["role"] = "function"
+			encoded["name"] = call.Name
+		case message.Role == RoleTool:
+			encoded["tool_call_id"] = call.ID
+		}
+		wire[i] = encoded
+	}
+	return wire
+}
+
+// functionCall is a called function as returned by OpenAI-compatible servers
+type functionCall struct {
+	Name string `json:"name"`
+	// Arguments is a JSON-encoded string per the OpenAI API; some servers
+	// send the object itself
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// parseResponse extracts the first tool call, accepting both tool_calls and
+// the legacy function_call regardless of the configured tool format
+func (c *OpenAIClient) parseResponse(respBytes []byte) (*ToolCall, error) {
+	var chatResp struct {
+		Choices []struct {
+			Message struct {
+				ToolCalls []struct {
+					ID       string       `json:"id"`
+					Function functionCall `json:"function"`
+				} `json:"tool_calls"`
+				FunctionCall *functionCall `json:"function_call"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+
+	if err := json.Unmarshal(respBytes, &chatResp); err != nil {
+		return nil, fmt.Errorf("unmarshal %s response failed: %w", c.name, err)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return nil, nil
+	}
+
+	message := chatResp.Choices[0].Message
+	var function *functionCall
+	var id string
+	if len(message.ToolCalls) > 0 {
+		function = &message.ToolCalls[0].Function
+		id = message.ToolCalls[0].ID
+	} else if message.FunctionCall != nil {
+		function = message.FunctionCall
+	} else {
+		return nil, nil
+	}
+
+	arguments := string(function.Arguments)
+	var encoded string
+	if err := json.Unmarshal(function.Arguments, &encoded); err == nil {
+		arguments = encoded
+	}
+
+	if id == "" {
+		id = "call_" + uuid.NewString()
+	}
+
+	return &ToolCall{ID: id, Name: function.Name, Arguments: arguments}, nil
+}
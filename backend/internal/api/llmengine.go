@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// DefaultLLMMaxAttempts bounds how often a model is prompted for valid tool
+// output
+const DefaultLLMMaxAttempts = 3
+
+// LLMEngineConfig configures an LLMEngine
+type LLMEngineConfig struct {
+	// Name identifies the model in logs and fallback reasoning
+	Name   string
+	Client LLMClient
+	// MaxAttempts is the number of prompts, including re-prompts after invalid
+	// tool output; DefaultLLMMaxAttempts is used when zero
+	MaxAttempts int
+	// Fallback, when set, scores the portfolio after every attempt fails
+	// validation
+	Fallback RiskEngine
+	// Prompts renders the opening messages; the builtin inline prompt is used
+	// when nil
+	Prompts PromptBuilder
+}
+
+// LLMEngine is a RiskEngine that delegates scoring to a language model
+// through the analyze_portfolio_risk tool
+type LLMEngine struct {
+	name        string
+	client      LLMClient
+	maxAttempts int
+	fallback    RiskEngine
+	prompts     PromptBuilder
+}
+
+// NewLLMEngine creates a risk engine backed by an LLMClient
+func NewLLMEngine(cfg LLMEngineConfig) *LLMEngine {
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultLLMMaxAttempts
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = "LLM"
+	}
+
+	return &LLMEngine{
+		name:        name,
+		client:      cfg.Client,
+		maxAttempts: maxAttempts,
+		fallback:    cfg.Fallback,
+		prompts:     cfg.Prompts,
+	}
+}
+
+// Analyze asks the model to score the portfolio through the analyze_portfolio_risk
+// tool. Output that fails schema validation is sent back to the model with the
+// validation error, up to the configured number of attempts, before falling
+// back to the deterministic engine.
+func (e *LLMEngine) Analyze(ctx context.Context, riskRequest RiskRequest) (*RiskResponse, error) {
+	var prompt *Prompt
+	var err error
+	if e.prompts != nil {
+		prompt, err = e.prompts.Build(riskRequest)
+	} else {
+		prompt, err = builtinPrompt(riskRequest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to build prompt: %w", err)
+	}
+
+	messages := append([]ChatMessage(nil), prompt.Messages...)
+
+	var validationErr error
+	for attempt := 1; attempt <= e.maxAttempts; attempt++ {
+		call, err := e.client.Complete(ctx, messages, []Tool{analyzePortfolioTool})
+		if err != nil {
+			return nil, err
+		}
+
+		if call == nil {
+			validationErr = ErrLLMNoToolCall
+		} else {
+			riskResp, err := validateToolCall(call.Name, call.Arguments)
+			if err == nil {
+				riskResp.Path = PathToolCall
+				if attempt > 1 {
+					riskResp.Path = PathToolCallRetry
+				}
+				riskResp.Attempts = attempt
+				riskResp.PromptVersion = prompt.Version
+				riskResp.PromptTokens = prompt.EstimatedTokens
+				return riskResp, nil
+			}
+			validationErr = err
+		}
+
+		log.Printf("%s attempt %d/%d returned invalid tool output: %v", e.name, attempt, e.maxAttempts, validationErr)
+
+		// Re-prompt with the validation error so the model can correct itself.
+		// A rejected call is echoed and answered so the transcript stays one
+		// the server could have produced.
+		retry := fmt.Sprintf(
+			"Your previous answer was rejected: %v. Call the %s tool again with arguments that satisfy its schema exactly.",
+			validationErr, analyzePortfolioToolName,
+		)
+		if call != nil {
+			messages = append(messages,
+				ChatMessage{Role: RoleAssistant, ToolCall: call},
+				ChatMessage{Role: RoleTool, ToolCall: call, Content: retry},
+			)
+		} else {
+			messages = append(messages, ChatMessage{Role: RoleUser, Content: retry})
+		}
+	}
+
+	toolErr := &ToolCallError{Attempts: e.maxAttempts, Err: validationErr}
+	if e.fallback == nil {
+		return nil, &UpstreamError{Upstream: strings.ToLower(e.name), Kind: ErrUpstreamLLM, Err: toolErr}
+	}
+
+	riskResp, err := e.fallback.Analyze(ctx, riskRequest)
+	if err != nil {
+		return nil, fmt.Errorf("fallback engine failed: %w", errors.Join(err, toolErr))
+	}
+	riskResp.Path = PathFallback
+	riskResp.Attempts = e.maxAttempts
+	riskResp.PromptVersion = prompt.Version
+	riskResp.PromptTokens = prompt.EstimatedTokens
+	riskResp.Reasoning = append(riskResp.Reasoning, fmt.Sprintf(
+		"%s output was rejected (%v); this answer comes from the deterministic fallback engine", e.name, toolErr,
+	))
+
+	return riskResp, nil
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"dex-analyzer/internal/asi1fake"
+)
+
+func TestLLMEngineStopsWhenRequestIsCancelled(t *testing.T) {
+	// The model never answers; only the caller's context can end the call
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	client, err := NewOpenAIClient(LLMConfig{BaseURL: srv.URL, Model: "test"})
+	if err != nil {
+		t.Fatalf("NewOpenAIClient: %v", err)
+	}
+	engine := NewLLMEngine(LLMEngineConfig{Client: client})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = engine.Analyze(ctx, RiskRequest{Address: "0x1"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Analyze = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Analyze returned after %s, want it to stop with the request", elapsed)
+	}
+}
+
+// newScriptedLLM starts the fake ASI1 server with script and returns an
+// engine falling back to fallback, along with the fake to inspect requests
+func newScriptedLLM(t *testing.T, fallback RiskEngine, script ...asi1fake.Reply) (*LLMEngine, *asi1fake.Server) {
+	t.Helper()
+	fake := asi1fake.NewServer("", script...)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	client, err := NewOpenAIClient(LLMConfig{BaseURL: srv.URL, Model: "test"})
+	if err != nil {
+		t.Fatalf("NewOpenAIClient: %v", err)
+	}
+	return NewLLMEngine(LLMEngineConfig{Client: client, Fallback: fallback}), fake
+}
+
+func TestLLMEngineRetriesThenFallsBack(t *testing.T) {
+	invalidScore := asi1fake.ToolCall(map[string]interface{}{
+		"recommended_tokens": []string{}, "risk_score": 7, "reasoning": []string{"too risky"},
+	})
+	fallback := fixedEngine{RiskResponse{RiskScore: 0.15, Reasoning: []string{"native"}}}
+
+	tests := []struct {
+		name     string
+		script   []asi1fake.Reply
+		path     string
+		attempts int
+		score    float64
+	}{
+		{name: "valid", script: []asi1fake.Reply{asi1fake.Valid}, path: PathToolCall, attempts: 1, score: 0.42},
+		{name: "corrected", script: []asi1fake.Reply{asi1fake.MalformedToolCall(`{"risk_score":`), asi1fake.Valid}, path: PathToolCallRetry, attempts: 2, score: 0.42},
+		{
+			name:     "never valid",
+			script:   []asi1fake.Reply{asi1fake.MalformedToolCall(`{"risk_score":`), invalidScore, asi1fake.NoToolCall("I think it is fine.")},
+			path:     PathFallback,
+			attempts: 3,
+			score:    0.15,
+		},
+	}
+	for _, tt := range tests {
+		engine, fake := newScriptedLLM(t, fallback, tt.script...)
+		resp, err := engine.Analyze(context.Background(), RiskRequest{Address: "0x1"})
+		if err != nil {
+			t.Fatalf("%s: Analyze: %v", tt.name, err)
+		}
+		if resp.Path != tt.path || resp.Attempts != tt.attempts || resp.RiskScore != tt.score {
+			t.Errorf("%s: path %q after %d attempts scoring %v, want %q after %d scoring %v",
+				tt.name, resp.Path, resp.Attempts, resp.RiskScore, tt.path, tt.attempts, tt.score)
+		}
+		if got := len(fake.Requests()); got != tt.attempts {
+			t.Errorf("%s: sent %d requests, want %d", tt.name, got, tt.attempts)
+		}
+		if tt.path == PathFallback && !strings.Contains(strings.Join(resp.Reasoning, " "), "deterministic fallback") {
+			t.Errorf("%s: reasoning %q does not mention the fallback", tt.name, resp.Reasoning)
+		}
+	}
+}
+
+func TestLLMEngineRepromptsWithToolCallTranscript(t *testing.T) {
+	malformed := `{"risk_score":`
+	engine, fake := newScriptedLLM(t, nil, asi1fake.MalformedToolCall(malformed), asi1fake.NoToolCall("Fine."), asi1fake.Valid)
+	if _, err := engine.Analyze(context.Background(), RiskRequest{Address: "0x1"}); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+
+	type message struct {
+		Role      string  `json:"role"`
+		Content   *string `json:"content"`
+		ToolCalls []struct {
+			ID       string `json:"id"`
+			Type     string `json:"type"`
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+		ToolCallID string `json:"tool_call_id"`
+	}
+	var last struct {
+		Messages []message `json:"messages"`
+	}
+	requests := fake.Requests()
+	if err := json.Unmarshal(requests[len(requests)-1], &last); err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+
+	// The prompt, then the rejected call, its answer and the nudge after a
+	// plain text answer
+	replies := last.Messages[len(last.Messages)-3:]
+	call, answer, nudge := replies[0], replies[1], replies[2]
+	if call.Role != RoleAssistant || call.Content != nil || len(call.ToolCalls) != 1 ||
+		call.ToolCalls[0].ID != "call_fake" || call.ToolCalls[0].Type != "function" ||
+		call.ToolCalls[0].Function.Name != analyzePortfolioToolName || call.ToolCalls[0].Function.Arguments != malformed {
+		t.Errorf("rejected call echoed as %+v, want the original tool call", call)
+	}
+	if answer.Role != RoleTool || answer.ToolCallID != "call_fake" || answer.Content == nil || !strings.Contains(*answer.Content, "rejected") {
+		t.Errorf("rejection sent as %+v, want a tool message answering call_fake", answer)
+	}
+	if nudge.Role != RoleUser || nudge.Content == nil || !strings.Contains(*nudge.Content, ErrLLMNoToolCall.Error()) {
+		t.Errorf("missing tool call reported as %+v, want a user message", nudge)
+	}
+}
+
+func TestWireMessagesInFunctionsFormat(t *testing.T) {
+	client, err := NewOpenAIClient(LLMConfig{BaseURL: "http://localhost", ToolFormat: ToolFormatFunctions})
+	if err != nil {
+		t.Fatalf("NewOpenAIClient: %v", err)
+	}
+	call := &ToolCall{ID: "call_1", Name: analyzePortfolioToolName, Arguments: "{}"}
+	wire := client.wireMessages([]ChatMessage{
+		{Role: RoleAssistant, ToolCall: call},
+		{Role: RoleTool, ToolCall: call, Content: "rejected"},
+	})
+
+	want := []map[string]interface{}{
+		{"role": "assistant", "content": nil, "function_call": map[string]string{"name": analyzePortfolioToolName, "arguments": "{}"}},
+		{"role": "function", "name": analyzePortfolioToolName, "content": "rejected"},
+	}
+	if !reflect.DeepEqual(wire, want) {
+		t.Errorf("wireMessages = %v, want %v", wire, want)
+	}
+}
+
+func TestLLMEngineFallbackErrorKeepsBothCauses(t *testing.T) {
+	fallbackErr := &UpstreamError{Upstream: "agent", Kind: ErrUpstreamAgent, Err: context.DeadlineExceeded}
+	engine, _ := newScriptedLLM(t, failingEngine{fallbackErr}, asi1fake.NoToolCall("Fine."))
+
+	_, err := engine.Analyze(context.Background(), RiskRequest{Address: "0x1"})
+	var toolErr *ToolCallError
+	if !errors.Is(err, ErrUpstreamAgent) || !errors.As(err, &toolErr) || !errors.Is(err, ErrLLMNoToolCall) {
+		t.Errorf("Analyze = %v, want both the fallback error and the tool call error", err)
+	}
+	if status, resp, _ := classifyError(err); status != http.StatusGatewayTimeout || resp.Upstream != "agent" {
+		t.Errorf("classifyError = %d from %q, want %d from the fallback agent", status, resp.Upstream, http.StatusGatewayTimeout)
+	}
+}
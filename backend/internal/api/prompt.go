@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BuiltinPromptVersion is reported for the inline prompt used when an LLM
+// engine has no PromptBuilder
+const BuiltinPromptVersion = "builtin"
+
+// Prompt is a rendered conversation opening for an LLM engine
+type Prompt struct {
+	// Version identifies the template the messages were rendered from
+	Version  string
+	Messages []ChatMessage
+	// EstimatedTokens approximates the prompt size, zero when unknown
+	EstimatedTokens int
+}
+
+// PromptBuilder renders the prompt for a portfolio. RiskRequest.PromptVersion
+// and RiskRequest.RiskProfile select the template and its variables.
+type PromptBuilder interface {
+	Build(req RiskRequest) (*Prompt, error)
+}
+
+// PromptValidator checks the risk profile and prompt version a request
+// selects, so unknown values are rejected before any portfolio is fetched
+type PromptValidator interface {
+	Validate(riskProfile, version string) error
+}
+
+// builtinPrompt dumps the whole portfolio JSON into a single user message
+func builtinPrompt(req RiskRequest) (*Prompt, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal riskRequest: %w", err)
+	}
+
+	userContent := fmt.Sprintf(
+		`Analyze the following portfolio JSON and return recommendations using the tool schema provided: %s`,
+		string(reqJSON),
+	)
+
+	return &Prompt{
+		Version:  BuiltinPromptVersion,
+		Messages: []ChatMessage{{Role: RoleUser, Content: userContent}},
+	}, nil
+}
@@ -0,0 +1,11 @@
+package api
+
+import "context"
+
+// PortfolioProvider fetches a wallet's token and app balances and returns them
+// in the RiskRequest shape consumed by the risk analyzers. An empty chainIDs
+// list fetches balances on every supported chain. Fetching stops when ctx is
+// cancelled.
+type PortfolioProvider interface {
+	FetchPortfolio(ctx context.Context, address string, chainIDs []int) (*RiskRequest, error)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// NameResolver resolves wallet names such as vitalik.eth or jesse.base.eth
+// to addresses
+type NameResolver interface {
+	// Resolve returns the address a name points to. Names without an address
+	// return ErrNameNotFound and malformed names ErrInvalidName.
+	Resolve(ctx context.Context, name string) (string, error)
+}
+
+// zeroAddress is what unset name records resolve to
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// isName reports whether an address parameter is a name rather than a hex
+// address. Names are told apart by their dot, since labels such as
+// 0xmons.eth may themselves start with 0x.
+func isName(value string) bool {
+	return strings.Contains(value, ".")
+}
+
+// resolveWallet takes a 0x address or a name and returns the canonical
+// address together with the lowercased name it was resolved from, if any
+func (s *Server) resolveWallet(ctx context.Context, value string) (string, string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", "", fmt.Errorf("%w: address is required", ErrInvalidRequest)
+	}
+	if !isName(value) {
+		address, err := parseAddress(value)
+		return address, "", err
+	}
+
+	if s.resolver == nil {
+		return "", "", fmt.Errorf("%w: name resolution is disabled, pass a 0x address instead of %q", ErrInvalidAddress, value)
+	}
+	resolved, err := s.resolver.Resolve(ctx, value)
+	if err != nil {
+		return "", "", err
+	}
+	// A resolver that hands back garbage failed upstream; the zero address
+	// is how unset records read on chain
+	address, err := parseAddress(resolved)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s resolved to an unusable address: %w", ErrUpstreamRPC, value, err)
+	}
+	if address == zeroAddress {
+		return "", "", fmt.Errorf("%w: %s resolves to the zero address", ErrNameNotFound, value)
+	}
+	return address, strings.ToLower(value), nil
+}
@@ -0,0 +1,120 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"dex-analyzer/internal/api"
+	"dex-analyzer/internal/ens"
+	"dex-analyzer/internal/rpcfake"
+)
+
+const (
+	sampleWallet = api.SampleWallet
+	monsWallet   = "0x2222222222222222222222222222222222222222"
+)
+
+func newResolvingServer(t *testing.T) *api.Server {
+	t.Helper()
+	rpc := httptest.NewServer(rpcfake.NewServer(map[string]string{
+		"sample.eth":      sampleWallet,
+		"sample.base.eth": sampleWallet,
+		"0xmons.eth":      monsWallet,
+	}))
+	t.Cleanup(rpc.Close)
+
+	server, err := api.NewServer(api.Config{
+		Portfolio:     api.EmptyProvider{},
+		Engines:       map[string]api.RiskEngine{"fixed": api.FixedEngine{}},
+		DefaultEngine: "fixed",
+		Resolver:      ens.NewResolver(ens.Config{ENSRPCURL: rpc.URL, BaseRPCURL: rpc.URL}),
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return server
+}
+
+func TestPositionsResolvesNames(t *testing.T) {
+	server := newResolvingServer(t)
+
+	tests := []struct {
+		input   string
+		status  int
+		address string
+		name    string
+		code    string
+	}{
+		{input: "sample.eth", status: http.StatusOK, address: sampleWallet, name: "sample.eth"},
+		{input: "Sample.Base.Eth", status: http.StatusOK, address: sampleWallet, name: "sample.base.eth"},
+		{input: "0xmons.eth", status: http.StatusOK, address: monsWallet, name: "0xmons.eth"},
+		{input: sampleWallet, status: http.StatusOK, address: sampleWallet},
+		{input: "unknown.eth", status: http.StatusNotFound, code: api.CodeNameNotFound},
+		{input: "bad..eth", status: http.StatusBadRequest, code: api.CodeInvalidName},
+		{input: "0x1234", status: http.StatusBadRequest, code: api.CodeInvalidAddress},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/positions?address="+url.QueryEscape(tt.input), nil)
+		server.GetPositions(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d (%s)", tt.input, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		var body struct {
+			Address string `json:"address"`
+			Name    string `json:"name"`
+			Code    string `json:"code"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if body.Address != tt.address || body.Name != tt.name || body.Code != tt.code {
+			t.Errorf("%s: got address %q, name %q, code %q; want %q, %q, %q",
+				tt.input, body.Address, body.Name, body.Code, tt.address, tt.name, tt.code)
+		}
+	}
+}
+
+// fixedResolver resolves every name to the same, possibly unusable, address
+type fixedResolver string
+
+func (r fixedResolver) Resolve(ctx context.Context, name string) (string, error) {
+	return string(r), nil
+}
+
+func TestPositionsRejectsUnusableResolution(t *testing.T) {
+	tests := []struct {
+		resolved string
+		status   int
+		code     string
+	}{
+		{resolved: "0x0000000000000000000000000000000000000000", status: http.StatusNotFound, code: api.CodeNameNotFound},
+		{resolved: "0x1234", status: http.StatusBadGateway, code: api.CodeUpstreamRPC},
+		{resolved: "not an address", status: http.StatusBadGateway, code: api.CodeUpstreamRPC},
+	}
+	for _, tt := range tests {
+		server, err := api.NewServer(api.Config{
+			Portfolio:     api.EmptyProvider{},
+			Engines:       map[string]api.RiskEngine{"fixed": api.FixedEngine{}},
+			DefaultEngine: "fixed",
+			Resolver:      fixedResolver(tt.resolved),
+		})
+		if err != nil {
+			t.Fatalf("NewServer: %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		server.GetPositions(rec, httptest.NewRequest(http.MethodGet, "/positions?address=sample.eth", nil))
+		var body api.ErrorResponse
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != tt.status || body.Code != tt.code {
+			t.Errorf("resolved to %q: status %d, code %q; want %d, %q", tt.resolved, rec.Code, body.Code, tt.status, tt.code)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHistoryLimit caps the snapshots returned by /wallets/{address}/history
+const DefaultHistoryLimit = 100
+
+// ErrSnapshotNotFound is returned by a SnapshotStore for unknown snapshot IDs
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot is a persisted analysis: the portfolio that was scored and the
+// response that was returned
+type Snapshot struct {
+	ID        string        `json:"id"`
+	Address   string        `json:"address"`
+	CreatedAt time.Time     `json:"created_at"`
+	Scope     SnapshotScope `json:"scope"`
+	Request   RiskRequest   `json:"request"`
+	Response  RiskResponse  `json:"response"`
+}
+
+// SnapshotScope records the options that decided which holdings a snapshot
+// covers. Snapshots are only comparable within the same scope.
+type SnapshotScope struct {
+	// Chains are the requested chain IDs, sorted; empty means every chain
+	Chains []int   `json:"chains,omitempty"`
+	MinUSD float64 `json:"min_usd,omitempty"`
+}
+
+// Equal reports whether two scopes cover the same holdings
+func (s SnapshotScope) Equal(other SnapshotScope) bool {
+	return slices.Equal(s.Chains, other.Chains) && s.MinUSD == other.MinUSD
+}
+
+func (s SnapshotScope) String() string {
+	chains := "all chains"
+	if len(s.Chains) > 0 {
+		ids := make([]string, len(s.Chains))
+		for i, id := range s.Chains {
+			ids[i] = strconv.Itoa(id)
+		}
+		chains = "chains " + strings.Join(ids, ",")
+	}
+	return fmt.Sprintf("%s, min_usd %g", chains, s.MinUSD)
+}
+
+// SnapshotSummary is the history entry of a snapshot
+type SnapshotSummary struct {
+	ID              string    `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	Engine          string    `json:"engine,omitempty"`
+	PromptVersion   string    `json:"prompt_version,omitempty"`
+	RiskScore       float64   `json:"risk_score"`
+	TotalBalanceUSD float64   `json:"total_balance_usd"`
+	Chains          []int     `json:"chains,omitempty"`
+	Truncated       bool      `json:"truncated,omitempty"`
+	// Scope is the chain and dust scope the snapshot was taken with
+	Scope SnapshotScope `json:"scope"`
+}
+
+// Summary condenses a snapshot for history listings
+func (s Snapshot) Summary() SnapshotSummary {
+	summary := SnapshotSummary{
+		ID:              s.ID,
+		CreatedAt:       s.CreatedAt,
+		Engine:          s.Response.Engine,
+		PromptVersion:   s.Response.PromptVersion,
+		RiskScore:       s.Response.RiskScore,
+		TotalBalanceUSD: s.Request.TokenBalances.TotalBalanceUSD + s.Request.AppBalances.TotalBalanceUSD,
+		Truncated:       s.Response.Truncated,
+		Scope:           s.Scope,
+	}
+	for _, chain := range s.Response.Chains {
+		summary.Chains = append(summary.Chains, chain.ChainID)
+	}
+	return summary
+}
+
+// withBalances fills in the response balances, which are stored only once
+// as part of the request
+func (s *Snapshot) withBalances() *Snapshot {
+	s.Response.TokenBalances = &s.Request.TokenBalances
+	s.Response.AppBalances = &s.Request.AppBalances
+	return s
+}
+
+// SnapshotStore persists analyses per wallet address. Addresses are passed
+// in canonical lowercase form.
+type SnapshotStore interface {
+	// NewID allocates the ID of the next snapshot
+	NewID() string
+	Save(snapshot Snapshot) error
+	// History lists up to limit snapshots of an address, newest first
+	History(address string, limit int) ([]SnapshotSummary, error)
+	// Get loads a snapshot, returning ErrSnapshotNotFound for unknown IDs
+	Get(address, id string) (*Snapshot, error)
+}
+
+// HistoryResponse is returned by /wallets/{address}/history
+type HistoryResponse struct {
+	Address   string            `json:"address"`
+	Snapshots []SnapshotSummary `json:"snapshots"`
+}
+
+// saveSnapshot persists an analysis taken with scope and records its ID on
+// the response. Failures are logged rather than failing the request.
+func (s *Server) saveSnapshot(riskRequest RiskRequest, riskResponse *RiskResponse, scope SnapshotScope) {
+	if s.snapshots == nil {
+		return
+	}
+
+	snapshot := Snapshot{
+		ID:        s.snapshots.NewID(),
+		Address:   strings.ToLower(riskRequest.Address),
+		CreatedAt: time.Now().UTC(),
+		Scope:     scope,
+		Request:   riskRequest,
+	}
+	riskResponse.SnapshotID = snapshot.ID
+	snapshot.Response = *riskResponse
+	// The request already holds the balances; withBalances restores them
+	snapshot.Response.TokenBalances = nil
+	snapshot.Response.AppBalances = nil
+
+	if err := s.snapshots.Save(snapshot); err != nil {
+		log.Printf("Failed to save snapshot for %s: %v", snapshot.Address, err)
+		riskResponse.SnapshotID = ""
+	}
+}
+
+// walletAddress reads and validates the {address} path value
+func walletAddress(w http.ResponseWriter, r *http.Request) (string, bool) {
+	address, err := parseAddress(r.PathValue("address"))
+	if err != nil {
+		writeError(w, r, err)
+		return "", false
+	}
+	return address, true
+}
+
+// GetHistory lists the stored snapshots of a wallet, newest first
+func (s *Server) GetHistory(w http.ResponseWriter, r *http.Request) {
+	if s.snapshots == nil {
+		writeError(w, r, ErrSnapshotsDisabled)
+		return
+	}
+	address, ok := walletAddress(w, r)
+	if !ok {
+		return
+	}
+
+	limit := DefaultHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeError(w, r, fmt.Errorf("%w: limit must be a positive integer", ErrInvalidRequest))
+			return
+		}
+		limit = n
+	}
+
+	history, err := s.snapshots.History(address, limit)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to load history: %w", err))
+		return
+	}
+	if history == nil {
+		history = []SnapshotSummary{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HistoryResponse{Address: address, Snapshots: history})
+}
+
+// GetSnapshot returns a stored snapshot of a wallet
+func (s *Server) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	if s.snapshots == nil {
+		writeError(w, r, ErrSnapshotsDisabled)
+		return
+	}
+	address, ok := walletAddress(w, r)
+	if !ok {
+		return
+	}
+
+	snapshot, err := s.snapshots.Get(address, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to load snapshot: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot.withBalances())
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSnapshotsStoreBalancesOnce(t *testing.T) {
+	store := &memoryStore{}
+	server, err := NewServer(Config{
+		Portfolio:     emptyProvider{},
+		Engines:       map[string]RiskEngine{"fixed": fixedEngine{}},
+		DefaultEngine: "fixed",
+		Snapshots:     store,
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	portfolio := RiskRequest{
+		Address:       sampleWallet,
+		TokenBalances: TokenBalances{TotalBalanceUSD: 500, ByToken: []TokenBalance{{Symbol: "USDC", BalanceUSD: 500}}},
+		AppBalances:   AppBalances{TotalBalanceUSD: 100, ByApp: []AppBalance{{App: App{DisplayName: "Aave V3", Slug: "aave-v3"}}}},
+	}
+	analysis := &RiskResponse{RiskScore: 0.2, TokenBalances: &portfolio.TokenBalances, AppBalances: &portfolio.AppBalances}
+	server.saveSnapshot(portfolio, analysis, SnapshotScope{})
+
+	if analysis.SnapshotID == "" || analysis.TokenBalances == nil || analysis.AppBalances == nil {
+		t.Fatalf("analysis = %+v, want its snapshot ID and balances", analysis)
+	}
+	stored := store.snapshots[0]
+	if stored.Response.TokenBalances != nil || stored.Response.AppBalances != nil {
+		t.Errorf("stored response repeats the balances of the request")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/wallets/"+sampleWallet+"/snapshots/"+analysis.SnapshotID, nil)
+	r.SetPathValue("address", sampleWallet)
+	r.SetPathValue("id", analysis.SnapshotID)
+	rec := httptest.NewRecorder()
+	server.GetSnapshot(rec, r)
+
+	var served Snapshot
+	if err := json.NewDecoder(rec.Body).Decode(&served); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if served.Response.TokenBalances == nil || served.Response.TokenBalances.TotalBalanceUSD != 500 ||
+		served.Response.AppBalances == nil || served.Response.AppBalances.TotalBalanceUSD != 100 {
+		t.Errorf("served response balances = %+v and %+v, want the request's", served.Response.TokenBalances, served.Response.AppBalances)
+	}
+}
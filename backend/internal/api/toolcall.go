@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// analyzePortfolioToolName is the function the LLM must call with its verdict
+const analyzePortfolioToolName = "analyze_portfolio_risk"
+
+// Paths an LLM-backed analysis can take to produce its answer
+const (
+	// PathToolCall means the first tool call passed validation
+	PathToolCall = "tool_call"
+	// PathToolCallRetry means a tool call passed validation after re-prompting
+	PathToolCallRetry = "tool_call_retry"
+	// PathFallback means every attempt failed validation and the fallback
+	// engine produced the answer
+	PathFallback = "fallback"
+)
+
+// ToolCallError reports LLM tool-call output that failed schema validation
+// on every attempt
+type ToolCallError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ToolCallError) Error() string {
+	return fmt.Sprintf("invalid %s tool call after %d attempt(s): %v", analyzePortfolioToolName, e.Attempts, e.Err)
+}
+
+func (e *ToolCallError) Unwrap() error {
+	return e.Err
+}
+
+// analyzePortfolioTool is the tool declaration sent to the LLM. Tool call
+// arguments are validated against the same schema by validateToolCall.
+var analyzePortfolioTool = Tool{
+	Name:        analyzePortfolioToolName,
+	Description: "Analyze a user's DeFi portfolio and recommend risk-aware actions.",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"recommended_tokens": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]string{"type": "string"},
+				"description": "List of token symbols recommended for the user to hold or accumulate.",
+			},
+			"risk_score": map[string]interface{}{
+				"type":        "number",
+				"minimum":     0,
+				"maximum":     1,
+				"description": "Portfolio risk score from 0 (safe) to 1 (high risk).",
+			},
+			"reasoning": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]string{"type": "string"},
+				"minItems":    1,
+				"description": "Explanations for the risk score and token recommendations.",
+			},
+		},
+		"required":             []string{"recommended_tokens", "risk_score", "reasoning"},
+		"additionalProperties": false,
+	},
+}
+
+// validateToolCall checks a tool call against the analyze_portfolio_risk
+// schema and converts its arguments into a RiskResponse
+func validateToolCall(name, arguments string) (*RiskResponse, error) {
+	if name != analyzePortfolioToolName {
+		return nil, fmt.Errorf("called tool %q, expected %q", name, analyzePortfolioToolName)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &fields); err != nil {
+		return nil, fmt.Errorf("arguments are not a JSON object: %v", err)
+	}
+
+	for _, field := range []string{"recommended_tokens", "risk_score", "reasoning"} {
+		value, ok := fields[field]
+		if !ok {
+			return nil, fmt.Errorf("missing required field %q", field)
+		}
+		if string(value) == "null" {
+			return nil, fmt.Errorf("field %q must not be null", field)
+		}
+	}
+	if len(fields) != 3 {
+		for field := range fields {
+			switch field {
+			case "recommended_tokens", "risk_score", "reasoning":
+			default:
+				return nil, fmt.Errorf("unexpected field %q", field)
+			}
+		}
+	}
+
+	var riskResp RiskResponse
+	if err := json.Unmarshal(fields["risk_score"], &riskResp.RiskScore); err != nil {
+		return nil, fmt.Errorf("risk_score must be a number, got %s", fields["risk_score"])
+	}
+	if math.IsNaN(riskResp.RiskScore) || riskResp.RiskScore < 0 || riskResp.RiskScore > 1 {
+		return nil, fmt.Errorf("risk_score %v is outside [0, 1]", riskResp.RiskScore)
+	}
+
+	if err := json.Unmarshal(fields["recommended_tokens"], &riskResp.RecommendedTokens); err != nil {
+		return nil, fmt.Errorf("recommended_tokens must be an array of strings")
+	}
+	for i, token := range riskResp.RecommendedTokens {
+		if token == "" {
+			return nil, fmt.Errorf("recommended_tokens[%d] is empty", i)
+		}
+	}
+
+	if err := json.Unmarshal(fields["reasoning"], &riskResp.Reasoning); err != nil {
+		return nil, fmt.Errorf("reasoning must be an array of strings")
+	}
+	if len(riskResp.Reasoning) == 0 {
+		return nil, fmt.Errorf("reasoning must contain at least one entry")
+	}
+
+	return &riskResp, nil
+}
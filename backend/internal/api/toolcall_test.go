@@ -0,0 +1,68 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateToolCall(t *testing.T) {
+	tests := []struct {
+		name      string
+		tool      string
+		arguments string
+		err       string
+	}{
+		{name: "valid", arguments: `{"recommended_tokens": ["USDC"], "risk_score": 0.4, "reasoning": ["ok"]}`},
+		{name: "no tokens", arguments: `{"recommended_tokens": [], "risk_score": 0, "reasoning": ["ok"]}`},
+		{name: "score of one", arguments: `{"recommended_tokens": [], "risk_score": 1, "reasoning": ["ok"]}`},
+		{name: "other tool", tool: "get_weather", arguments: `{}`, err: `called tool "get_weather"`},
+		{name: "not JSON", arguments: `{"risk_score": 0.4`, err: "not a JSON object"},
+		{name: "array", arguments: `[0.4]`, err: "not a JSON object"},
+		{name: "missing tokens", arguments: `{"risk_score": 0.4, "reasoning": ["ok"]}`, err: `missing required field "recommended_tokens"`},
+		{name: "missing score", arguments: `{"recommended_tokens": [], "reasoning": ["ok"]}`, err: `missing required field "risk_score"`},
+		{name: "missing reasoning", arguments: `{"recommended_tokens": [], "risk_score": 0.4}`, err: `missing required field "reasoning"`},
+		{name: "null score", arguments: `{"recommended_tokens": [], "risk_score": null, "reasoning": ["ok"]}`, err: `"risk_score" must not be null`},
+		{name: "extra field", arguments: `{"recommended_tokens": [], "risk_score": 0.4, "reasoning": ["ok"], "confidence": 0.9}`, err: `unexpected field "confidence"`},
+		{name: "negative score", arguments: `{"recommended_tokens": [], "risk_score": -0.1, "reasoning": ["ok"]}`, err: "outside [0, 1]"},
+		{name: "score above one", arguments: `{"recommended_tokens": [], "risk_score": 1.5, "reasoning": ["ok"]}`, err: "outside [0, 1]"},
+		{name: "score as string", arguments: `{"recommended_tokens": [], "risk_score": "0.4", "reasoning": ["ok"]}`, err: "risk_score must be a number"},
+		{name: "tokens as string", arguments: `{"recommended_tokens": "USDC", "risk_score": 0.4, "reasoning": ["ok"]}`, err: "recommended_tokens must be an array of strings"},
+		{name: "numeric token", arguments: `{"recommended_tokens": [1], "risk_score": 0.4, "reasoning": ["ok"]}`, err: "recommended_tokens must be an array of strings"},
+		{name: "empty token", arguments: `{"recommended_tokens": [""], "risk_score": 0.4, "reasoning": ["ok"]}`, err: "recommended_tokens[0] is empty"},
+		{name: "reasoning as string", arguments: `{"recommended_tokens": [], "risk_score": 0.4, "reasoning": "ok"}`, err: "reasoning must be an array of strings"},
+		{name: "no reasoning", arguments: `{"recommended_tokens": [], "risk_score": 0.4, "reasoning": []}`, err: "at least one entry"},
+	}
+	for _, tt := range tests {
+		tool := tt.tool
+		if tool == "" {
+			tool = analyzePortfolioToolName
+		}
+		resp, err := validateToolCall(tool, tt.arguments)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got %+v, %v; want an error containing %q", tt.name, resp, err, tt.err)
+		}
+	}
+}
+
+func TestValidateToolCallConvertsArguments(t *testing.T) {
+	resp, err := validateToolCall(analyzePortfolioToolName,
+		`{"recommended_tokens": ["USDC", "ETH"], "risk_score": 0.42, "reasoning": ["Concentrated", "Leveraged"]}`)
+	if err != nil {
+		t.Fatalf("validateToolCall: %v", err)
+	}
+	want := &RiskResponse{
+		RecommendedTokens: []string{"USDC", "ETH"},
+		RiskScore:         0.42,
+		Reasoning:         []string{"Concentrated", "Leveraged"},
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("validateToolCall = %+v, want %+v", resp, want)
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const sampleWallet = "0x1111111111111111111111111111111111111111"
+
+func readAppBalancesFixture(t *testing.T) []byte {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("..", "..", DefaultZapperFixturesDir, sampleWallet, "AppBalances-*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no AppBalances fixture for %s: %v", sampleWallet, err)
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseAppBalancesFixture(t *testing.T) {
+	p := &ZapperProvider{}
+	balances, page, err := p.parseAppBalancesResponse(readAppBalancesFixture(t))
+	if err != nil {
+		t.Fatalf("parseAppBalancesResponse: %v", err)
+	}
+
+	if balances.TotalBalanceUSD != 2600 || balances.TotalCount != 2 || page.HasNextPage {
+		t.Errorf("totals = %v USD, %d apps, next page %v; want 2600 USD, 2 apps, no next page",
+			balances.TotalBalanceUSD, balances.TotalCount, page.HasNextPage)
+	}
+
+	base := Network{Name: "Base", Slug: "base", ChainID: 8453}
+	type position struct {
+		app, slug, address string
+		balanceUSD         float64
+		tokens             []TokenPosition
+	}
+	want := []position{
+		{
+			app:        "Aave V3",
+			slug:       "aave-v3",
+			address:    "0xa238dd80c259a72e81d7e4664a9801593f98d1c5",
+			balanceUSD: 500,
+			tokens: []TokenPosition{
+				{MetaType: "SUPPLIED", Token: TokenBalance{TokenAddress: "0x4200000000000000000000000000000000000006", Symbol: "WETH", Decimals: 18, Price: 2500, Balance: 2.4, BalanceUSD: 6000, Network: base}},
+				{MetaType: "BORROWED", Token: TokenBalance{TokenAddress: "0x833589fcd6edb6e08f4c7c32d4f71b54bda02913", Symbol: "USDC", Decimals: 6, Price: 1, Balance: 5500, BalanceUSD: 5500, Network: base}},
+			},
+		},
+		{
+			app:        "Aerodrome",
+			slug:       "aerodrome",
+			address:    "0xebf418fe2512e7e6bd9b87a8f0f294acdc67e6b4",
+			balanceUSD: 2100,
+			tokens: []TokenPosition{
+				{MetaType: "LOCKED", Token: TokenBalance{TokenAddress: "0x940181a94a35a4569e4529a3cdfb74e38fd98631", Symbol: "AERO", Decimals: 18, Price: 0.85, Balance: 2470.588235, BalanceUSD: 2100, Network: base}},
+			},
+		},
+	}
+
+	if len(balances.ByApp) != len(want) {
+		t.Fatalf("got %d apps, want %d", len(balances.ByApp), len(want))
+	}
+	for i, w := range want {
+		app := balances.ByApp[i]
+		if app.App.DisplayName != w.app || app.App.Slug != w.slug || app.Network != base {
+			t.Errorf("app %d = %+v on %+v, want %q (%s) on %+v", i, app.App, app.Network, w.app, w.slug, base)
+		}
+		if len(app.Balances) != 1 {
+			t.Fatalf("%s: got %d positions, want 1", w.app, len(app.Balances))
+		}
+		pos := app.Balances[0]
+		if pos.Address != w.address || pos.BalanceUSD != w.balanceUSD {
+			t.Errorf("%s position = %s worth %v, want %s worth %v", w.app, pos.Address, pos.BalanceUSD, w.address, w.balanceUSD)
+		}
+		if len(pos.Tokens) != len(w.tokens) {
+			t.Fatalf("%s: got %d position tokens, want %d", w.app, len(pos.Tokens), len(w.tokens))
+		}
+		for j, wt := range w.tokens {
+			got := pos.Tokens[j]
+			if got.MetaType != wt.MetaType {
+				t.Errorf("%s token %d meta_type = %q, want %q", w.app, j, got.MetaType, wt.MetaType)
+			}
+			g, e := got.Token, wt.Token
+			if g.TokenAddress != e.TokenAddress || g.Symbol != e.Symbol || g.Decimals != e.Decimals ||
+				g.Price != e.Price || g.Balance != e.Balance || g.BalanceUSD != e.BalanceUSD || g.Network != e.Network {
+				t.Errorf("%s token %d = %+v, want %+v", w.app, j, g, e)
+			}
+		}
+	}
+}
+
+func TestParseAppBalancesFlexibleNumbers(t *testing.T) {
+	body := []byte(`{"data": {"portfolioV2": {"appBalances": {"totalBalanceUSD": 12.5, "byApp": {
+		"totalCount": 1,
+		"pageInfo": {"hasNextPage": true, "endCursor": "abc"},
+		"edges": [{"node": {
+			"app": {"displayName": "Morpho", "category": {"name": "Lending"}},
+			"network": {"name": "Sonic", "chainId": 146},
+			"positionBalances": {"edges": [{"node": {
+				"address": "",
+				"groupLabel": "Vault",
+				"balanceUSD": 12.5,
+				"tokens": [{"metaType": "SUPPLIED", "token": {
+					"address": "0xabc",
+					"symbol": "USDC",
+					"decimals": "6",
+					"price": null,
+					"balance": "12.5",
+					"balanceUSD": "12.5"
+				}}]
+			}}]}
+		}}]
+	}}}}}`)
+
+	p := &ZapperProvider{}
+	balances, page, err := p.parseAppBalancesResponse(body)
+	if err != nil {
+		t.Fatalf("parseAppBalancesResponse: %v", err)
+	}
+	if !page.HasNextPage || page.EndCursor != "abc" {
+		t.Errorf("page = %+v, want the next page after abc", page)
+	}
+
+	app := balances.ByApp[0]
+	if app.App.Slug != "morpho" {
+		t.Errorf("app slug = %q, want one derived from the display name", app.App.Slug)
+	}
+	wantNetwork := Network{Name: "Sonic", Slug: "sonic", ChainID: 146}
+	if app.Network != wantNetwork {
+		t.Errorf("network = %+v, want %+v", app.Network, wantNetwork)
+	}
+	pos := app.Balances[0]
+	if pos.Address != "Vault" {
+		t.Errorf("position address = %q, want the group label", pos.Address)
+	}
+	token := pos.Tokens[0].Token
+	if token.Decimals != 6 || token.Price != 0 || token.Balance != 12.5 || token.BalanceUSD != 12.5 || token.BalanceRaw != "12500000" {
+		t.Errorf("token = %+v, want decimals 6, price 0, balance 12.5 (12500000 raw) worth 12.5", token)
+	}
+}
+
+func TestFlexFloat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		err  bool
+	}{
+		{in: `1.5`, want: 1.5},
+		{in: `"1.5"`, want: 1.5},
+		{in: `"1e3"`, want: 1000},
+		{in: `null`, want: 0},
+		{in: `""`, want: 0},
+		{in: `"abc"`, err: true},
+	}
+	for _, tt := range tests {
+		var f flexFloat
+		err := json.Unmarshal([]byte(tt.in), &f)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: err = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if !tt.err && float64(f) != tt.want {
+			t.Errorf("%s = %v, want %v", tt.in, float64(f), tt.want)
+		}
+	}
+}
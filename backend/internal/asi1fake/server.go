@@ -0,0 +1,185 @@
+// Package asi1fake is a local stand-in for the ASI:One OpenAI-compatible chat
+// completions endpoint. It answers with scripted replies so the LLM analysis
+// path can be exercised deterministically and without network access.
+package asi1fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DefaultToolName is the tool the analyzer expects to be called
+const DefaultToolName = "analyze_portfolio_risk"
+
+// Reply is one scripted response. Exactly one of the shapes applies, checked
+// in this order: Status (an error response with Body), Raw (a verbatim body),
+// Content (an assistant message without a tool call) and finally a tool call
+// of ToolName with Arguments.
+type Reply struct {
+	Status    int             `json:"status,omitempty"`
+	Body      string          `json:"body,omitempty"`
+	Raw       string          `json:"raw,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolName  string          `json:"tool_name,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	// ArgumentsText is sent as the arguments string verbatim, which allows
+	// scripting arguments that are not valid JSON
+	ArgumentsText string `json:"arguments_text,omitempty"`
+}
+
+// ToolCall scripts a call to analyze_portfolio_risk with args encoded as JSON
+func ToolCall(args interface{}) Reply {
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		panic(fmt.Sprintf("asi1fake: cannot encode tool arguments: %v", err))
+	}
+	return Reply{ToolName: DefaultToolName, Arguments: encoded}
+}
+
+// MalformedToolCall scripts a tool call whose arguments string is sent as is
+func MalformedToolCall(arguments string) Reply {
+	return Reply{ToolName: DefaultToolName, ArgumentsText: arguments}
+}
+
+// NoToolCall scripts a plain assistant answer without any tool call
+func NoToolCall(content string) Reply {
+	return Reply{Content: content}
+}
+
+// Error scripts a non-200 response
+func Error(status int, body string) Reply {
+	return Reply{Status: status, Body: body}
+}
+
+// Valid is a well-formed analyze_portfolio_risk answer
+var Valid = ToolCall(map[string]interface{}{
+	"recommended_tokens": []string{"USDC"},
+	"risk_score":         0.42,
+	"reasoning":          []string{"Scripted answer from the local ASI1 stand-in."},
+})
+
+// Server serves the scripted replies in order and repeats the last one once
+// the script is exhausted
+type Server struct {
+	mu       sync.Mutex
+	apiKey   string
+	script   []Reply
+	next     int
+	requests []json.RawMessage
+}
+
+// NewServer creates a fake chat completions server. When apiKey is not empty,
+// requests must carry it as a bearer token.
+func NewServer(apiKey string, script ...Reply) *Server {
+	if len(script) == 0 {
+		script = []Reply{Valid}
+	}
+	return &Server{apiKey: apiKey, script: script}
+}
+
+// LoadScript reads a JSON array of replies
+func LoadScript(path string) ([]Reply, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+
+	var script []Reply
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("failed to parse script: %w", err)
+	}
+	return script, nil
+}
+
+// Requests returns the bodies of the requests received so far
+func (s *Server) Requests() []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]json.RawMessage(nil), s.requests...)
+}
+
+// ServeHTTP handles POST <any prefix>/chat/completions
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		http.NotFound(w, r)
+		return
+	}
+	if s.apiKey != "" && r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": map[string]string{"message": "invalid api key"},
+		})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, json.RawMessage(body))
+	reply := s.script[s.next]
+	if s.next < len(s.script)-1 {
+		s.next++
+	}
+	s.mu.Unlock()
+
+	switch {
+	case reply.Status != 0 && reply.Status != http.StatusOK:
+		w.WriteHeader(reply.Status)
+		io.WriteString(w, reply.Body)
+	case reply.Raw != "":
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, reply.Raw)
+	case reply.Content != "":
+		writeJSON(w, http.StatusOK, completion(map[string]interface{}{
+			"role":    "assistant",
+			"content": reply.Content,
+		}, "stop"))
+	default:
+		arguments := reply.ArgumentsText
+		if arguments == "" {
+			arguments = string(reply.Arguments)
+		}
+		name := reply.ToolName
+		if name == "" {
+			name = DefaultToolName
+		}
+		writeJSON(w, http.StatusOK, completion(map[string]interface{}{
+			"role":    "assistant",
+			"content": nil,
+			"tool_calls": []map[string]interface{}{
+				{
+					"id":   "call_fake",
+					"type": "function",
+					"function": map[string]string{
+						"name":      name,
+						"arguments": arguments,
+					},
+				},
+			},
+		}, "tool_calls"))
+	}
+}
+
+// completion wraps a message in an OpenAI-style chat completion
+func completion(message map[string]interface{}, finishReason string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      "chatcmpl-fake",
+		"object":  "chat.completion",
+		"model":   "asi1-mini",
+		"choices": []map[string]interface{}{{"index": 0, "message": message, "finish_reason": finishReason}},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,206 @@
+// Package ens resolves ENS names (vitalik.eth) on Ethereum and Basenames
+// (jesse.base.eth) on Base to wallet addresses through plain eth_call
+// requests against any JSON-RPC endpoint. It implements api.NameResolver.
+//
+// Resolution reads the name's resolver from the registry and then the
+// resolver's addr record. Names are lowercased; full ENSIP-15 normalization
+// and offchain (CCIP-read) resolvers are not supported.
+package ens
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	"dex-analyzer/internal/address"
+	"dex-analyzer/internal/api"
+	"dex-analyzer/internal/upstream"
+)
+
+// Registries queried for names
+const (
+	// ENSRegistry is the ENS registry on Ethereum mainnet
+	ENSRegistry = "0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e"
+	// BaseRegistry is the Basenames registry on Base
+	BaseRegistry = "0xb94704422c2a1e396835a571837aa5ae53285a95"
+)
+
+// Public RPC endpoints used when none are configured
+const (
+	DefaultENSRPCURL  = "https://ethereum-rpc.publicnode.com"
+	DefaultBaseRPCURL = "https://mainnet.base.org"
+)
+
+// BasenameSuffix marks names that are resolved on Base
+const BasenameSuffix = ".base.eth"
+
+// Function selectors of the registry and resolver calls
+const (
+	selectorResolver = "0178b8bf" // resolver(bytes32)
+	selectorAddr     = "3b3b57de" // addr(bytes32)
+)
+
+// zeroAddress is returned for unset resolvers and addr records
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// Config configures a Resolver
+type Config struct {
+	// ENSRPCURL is an Ethereum mainnet JSON-RPC endpoint; DefaultENSRPCURL
+	// is used when empty
+	ENSRPCURL string
+	// BaseRPCURL is a Base JSON-RPC endpoint; DefaultBaseRPCURL is used
+	// when empty
+	BaseRPCURL string
+	// ENSClient and BaseClient send the RPC requests; clients with the
+	// upstream defaults are used when nil
+	ENSClient  *upstream.Client
+	BaseClient *upstream.Client
+}
+
+// Resolver resolves names against the ENS and Basenames registries
+type Resolver struct {
+	ens  chain
+	base chain
+}
+
+// chain is a registry reachable through a JSON-RPC endpoint
+type chain struct {
+	name     string
+	rpc      *rpcClient
+	registry string
+}
+
+// NewResolver creates a resolver for ENS names and Basenames
+func NewResolver(cfg Config) *Resolver {
+	ensURL := cfg.ENSRPCURL
+	if ensURL == "" {
+		ensURL = DefaultENSRPCURL
+	}
+	baseURL := cfg.BaseRPCURL
+	if baseURL == "" {
+		baseURL = DefaultBaseRPCURL
+	}
+	ensClient := cfg.ENSClient
+	if ensClient == nil {
+		ensClient = upstream.NewClient(upstream.Config{Name: "ens"})
+	}
+	baseClient := cfg.BaseClient
+	if baseClient == nil {
+		baseClient = upstream.NewClient(upstream.Config{Name: "basenames"})
+	}
+
+	return &Resolver{
+		ens:  chain{name: "ens", rpc: &rpcClient{url: ensURL, client: ensClient}, registry: ENSRegistry},
+		base: chain{name: "basenames", rpc: &rpcClient{url: baseURL, client: baseClient}, registry: BaseRegistry},
+	}
+}
+
+// Resolve implements api.NameResolver. Unknown names and names without an
+// address record return api.ErrNameNotFound.
+func (r *Resolver) Resolve(ctx context.Context, name string) (string, error) {
+	normalized, err := Normalize(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", api.ErrInvalidName, err)
+	}
+
+	c := r.ens
+	if strings.HasSuffix(normalized, BasenameSuffix) {
+		c = r.base
+	}
+	node := Namehash(normalized)
+
+	resolver, err := c.call(ctx, c.registry, selectorResolver, node)
+	if err != nil {
+		return "", err
+	}
+	if resolver == zeroAddress {
+		return "", fmt.Errorf("%w: %s has no resolver", api.ErrNameNotFound, normalized)
+	}
+
+	addr, err := c.call(ctx, resolver, selectorAddr, node)
+	if err != nil {
+		return "", err
+	}
+	if addr == zeroAddress {
+		return "", fmt.Errorf("%w: %s has no address record", api.ErrNameNotFound, normalized)
+	}
+	return addr, nil
+}
+
+// call runs a single-argument view function and decodes its address result
+func (c chain) call(ctx context.Context, to, selector string, node [32]byte) (string, error) {
+	result, err := c.rpc.ethCall(ctx, to, "0x"+selector+hex.EncodeToString(node[:]))
+	if err != nil {
+		return "", &api.UpstreamError{Upstream: c.name, Kind: api.ErrUpstreamRPC, Err: err}
+	}
+	addr, err := decodeAddress(result)
+	if err != nil {
+		return "", &api.UpstreamError{Upstream: c.name, Kind: api.ErrUpstreamRPC, Err: err}
+	}
+	return addr, nil
+}
+
+// decodeAddress reads an ABI-encoded address return value
+func decodeAddress(result string) (string, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid eth_call result %q: %w", result, err)
+	}
+	// A call to an account without code succeeds with empty output
+	if len(data) == 0 {
+		return zeroAddress, nil
+	}
+	if len(data) < 32 {
+		return "", fmt.Errorf("eth_call returned %d bytes, expected an address word", len(data))
+	}
+	return address.Parse("0x" + hex.EncodeToString(data[12:32]))
+}
+
+// Normalize lowercases a name and checks that it is made of non-empty,
+// dot-separated labels
+func Normalize(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", fmt.Errorf("name is empty")
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("name %q has no top-level domain such as .eth", name)
+	}
+	for _, label := range labels {
+		if label == "" {
+			return "", fmt.Errorf("name %q has an empty label", name)
+		}
+		if strings.ContainsAny(label, " \t\r\n/") {
+			return "", fmt.Errorf("name %q contains whitespace or a slash", name)
+		}
+	}
+	return name, nil
+}
+
+// Namehash computes the EIP-137 node of a normalized name
+func Namehash(name string) [32]byte {
+	var node [32]byte
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		labelHash := keccak256([]byte(labels[i]))
+		node = keccak256(node[:], labelHash[:])
+	}
+	return node
+}
+
+func keccak256(data ...[]byte) [32]byte {
+	hash := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		hash.Write(d)
+	}
+	var sum [32]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
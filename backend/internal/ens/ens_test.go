@@ -0,0 +1,24 @@
+package ens
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestNamehash(t *testing.T) {
+	// Test vectors from EIP-137
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "", want: "0000000000000000000000000000000000000000000000000000000000000000"},
+		{name: "eth", want: "93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae"},
+		{name: "foo.eth", want: "de9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"},
+	}
+	for _, tt := range tests {
+		node := Namehash(tt.name)
+		if got := hex.EncodeToString(node[:]); got != tt.want {
+			t.Errorf("Namehash(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ens
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"dex-analyzer/internal/upstream"
+)
+
+// rpcClient sends JSON-RPC requests to a single endpoint
+type rpcClient struct {
+	url    string
+	client *upstream.Client
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result string `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type callMessage struct {
+	To   string `json:"to"`
+	Data string `json:"data"`
+}
+
+// ethCall runs eth_call against the latest block and returns the hex result
+func (c *rpcClient) ethCall(ctx context.Context, to, data string) (string, error) {
+	requestBody, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "eth_call",
+		Params:  []interface{}{callMessage{To: to, Data: data}, "latest"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal eth_call request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	body, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp rpcResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse eth_call response: %w", err)
+	}
+	if resp.Error != nil {
+		return "", fmt.Errorf("eth_call failed: %s (code %d)", resp.Error.Message, resp.Error.Code)
+	}
+	return resp.Result, nil
+}
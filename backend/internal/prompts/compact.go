@@ -0,0 +1,148 @@
+package prompts
+
+import (
+	"math"
+	"sort"
+
+	"dex-analyzer/internal/api"
+)
+
+// Compaction defaults, used when the corresponding CompactionConfig field is zero
+const (
+	// DefaultTokenBudget is the estimated prompt size compaction aims for
+	DefaultTokenBudget = 8000
+	// DefaultDustUSD is the value below which holdings and positions are dust
+	DefaultDustUSD = 1.0
+	// DefaultTopN is how many holdings and positions are kept before the
+	// budget forces fewer
+	DefaultTopN = 50
+)
+
+// charsPerToken approximates the tokenizers of current chat models
+const charsPerToken = 4
+
+// messageOverheadTokens covers the role and framing of every chat message
+const messageOverheadTokens = 4
+
+// CompactionConfig bounds the portfolio data sent to the LLM
+type CompactionConfig struct {
+	TokenBudget int
+	DustUSD     float64
+	TopN        int
+}
+
+// Aggregate sums the holdings or positions folded out of the prompt
+type Aggregate struct {
+	Count      int
+	BalanceUSD float64
+}
+
+// Compaction describes how a portfolio was condensed for the prompt
+type Compaction struct {
+	// TopN is the number of holdings and positions kept
+	TopN    int
+	DustUSD float64
+	// Dust aggregates holdings and positions worth less than DustUSD
+	Dust Aggregate
+	// TailHoldings and TailPositions aggregate what did not make the top N
+	TailHoldings  Aggregate
+	TailPositions Aggregate
+}
+
+// EstimateTokens approximates the token count of chat messages from their length
+func EstimateTokens(messages []api.ChatMessage) int {
+	tokens := 0
+	for _, message := range messages {
+		tokens += messageOverheadTokens + (len(message.Content)+charsPerToken-1)/charsPerToken
+	}
+	return tokens
+}
+
+// compact drops dust and keeps the topN most valuable holdings and contract
+// positions of a portfolio, aggregating everything it removes
+func compact(req api.RiskRequest, dustUSD float64, topN int) (api.RiskRequest, Compaction) {
+	compaction := Compaction{TopN: topN, DustUSD: dustUSD}
+
+	var holdings []api.TokenBalance
+	for _, token := range req.TokenBalances.ByToken {
+		if math.Abs(token.BalanceUSD) < dustUSD {
+			compaction.Dust.Count++
+			compaction.Dust.BalanceUSD += token.BalanceUSD
+			continue
+		}
+		holdings = append(holdings, token)
+	}
+	sort.SliceStable(holdings, func(i, j int) bool {
+		return holdings[i].BalanceUSD > holdings[j].BalanceUSD
+	})
+	if len(holdings) > topN {
+		for _, token := range holdings[topN:] {
+			compaction.TailHoldings.Count++
+			compaction.TailHoldings.BalanceUSD += token.BalanceUSD
+		}
+		holdings = holdings[:topN]
+	}
+
+	// Rank contract positions across apps by gross exposure so a leveraged
+	// position with a small net value is not mistaken for dust
+	type rankedPosition struct {
+		app, position int
+		value         float64
+	}
+	var ranked []rankedPosition
+	for i, appBalance := range req.AppBalances.ByApp {
+		for j, contractPos := range appBalance.Balances {
+			value := grossUSD(contractPos)
+			if value < dustUSD {
+				compaction.Dust.Count++
+				compaction.Dust.BalanceUSD += contractPos.BalanceUSD
+				continue
+			}
+			ranked = append(ranked, rankedPosition{app: i, position: j, value: value})
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].value > ranked[j].value
+	})
+	keep := make(map[[2]int]bool)
+	for i, position := range ranked {
+		if i < topN {
+			keep[[2]int{position.app, position.position}] = true
+			continue
+		}
+		contractPos := req.AppBalances.ByApp[position.app].Balances[position.position]
+		compaction.TailPositions.Count++
+		compaction.TailPositions.BalanceUSD += contractPos.BalanceUSD
+	}
+
+	var apps []api.AppBalance
+	for i, appBalance := range req.AppBalances.ByApp {
+		var kept []api.ContractPosition
+		for j, contractPos := range appBalance.Balances {
+			if keep[[2]int{i, j}] {
+				kept = append(kept, contractPos)
+			}
+		}
+		if len(kept) > 0 {
+			appBalance.Balances = kept
+			apps = append(apps, appBalance)
+		}
+	}
+
+	req.TokenBalances.ByToken = holdings
+	req.AppBalances.ByApp = apps
+	return req, compaction
+}
+
+// grossUSD sums the absolute value of every token in a position, or its net
+// value when no tokens are reported
+func grossUSD(contractPos api.ContractPosition) float64 {
+	if len(contractPos.Tokens) == 0 {
+		return math.Abs(contractPos.BalanceUSD)
+	}
+	var gross float64
+	for _, tokenPos := range contractPos.Tokens {
+		gross += math.Abs(tokenPos.Token.BalanceUSD)
+	}
+	return gross
+}
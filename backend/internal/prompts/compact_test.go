@@ -0,0 +1,177 @@
+package prompts
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dex-analyzer/internal/api"
+)
+
+const sampleWallet = "0x1111111111111111111111111111111111111111"
+
+var base = api.Network{Name: "Base", Slug: "base", ChainID: 8453}
+
+func holding(symbol string, usd float64) api.TokenBalance {
+	return api.TokenBalance{Symbol: symbol, TokenAddress: "0x" + strings.ToLower(symbol), Network: base, BalanceUSD: usd}
+}
+
+func position(label string, usd float64, tokens ...api.TokenPosition) api.ContractPosition {
+	return api.ContractPosition{Address: "0x" + label, BalanceUSD: usd, DisplayProps: api.DisplayProps{Label: label}, Tokens: tokens}
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestCompact(t *testing.T) {
+	req := api.RiskRequest{
+		Address: sampleWallet,
+		TokenBalances: api.TokenBalances{ByToken: []api.TokenBalance{
+			holding("USDC", 500),
+			holding("DUST", 0.4),
+			holding("ETH", 2000),
+			holding("AERO", 50),
+			holding("DEGEN", 20),
+			// A tiny debt still counts as dust
+			holding("DEBT", -0.5),
+		}},
+		AppBalances: api.AppBalances{ByApp: []api.AppBalance{
+			{
+				App:     api.App{DisplayName: "Aave V3", Slug: "aave-v3"},
+				Network: base,
+				Balances: []api.ContractPosition{
+					// Leveraged: nearly no net value but large gross exposure
+					position("loop", 0.5,
+						api.TokenPosition{MetaType: "SUPPLIED", Token: api.TokenBalance{Symbol: "ETH", BalanceUSD: 3000}},
+						api.TokenPosition{MetaType: "BORROWED", Token: api.TokenBalance{Symbol: "USDC", BalanceUSD: -2999.5}}),
+					position("dust", 0.2),
+				},
+			},
+			{
+				App:      api.App{DisplayName: "Aerodrome", Slug: "aerodrome"},
+				Network:  base,
+				Balances: []api.ContractPosition{position("pool", 100), position("gauge", 30), position("bribe", 10)},
+			},
+		}},
+	}
+
+	compacted, compaction := compact(req, 1, 2)
+
+	var symbols []string
+	for _, token := range compacted.TokenBalances.ByToken {
+		symbols = append(symbols, token.Symbol)
+	}
+	if want := []string{"ETH", "USDC"}; !reflect.DeepEqual(symbols, want) {
+		t.Errorf("kept holdings %q, want %q", symbols, want)
+	}
+
+	var positions []string
+	for _, appBalance := range compacted.AppBalances.ByApp {
+		for _, contractPos := range appBalance.Balances {
+			positions = append(positions, appBalance.App.Slug+"/"+contractPos.DisplayProps.Label)
+		}
+	}
+	if want := []string{"aave-v3/loop", "aerodrome/pool"}; !reflect.DeepEqual(positions, want) {
+		t.Errorf("kept positions %q, want %q", positions, want)
+	}
+
+	if compaction.TopN != 2 || compaction.DustUSD != 1 {
+		t.Errorf("compaction reports top %d and dust %v, want 2 and 1", compaction.TopN, compaction.DustUSD)
+	}
+	aggregates := []struct {
+		name  string
+		got   Aggregate
+		count int
+		usd   float64
+	}{
+		{name: "dust", got: compaction.Dust, count: 3, usd: 0.4 - 0.5 + 0.2},
+		{name: "tail holdings", got: compaction.TailHoldings, count: 2, usd: 70},
+		{name: "tail positions", got: compaction.TailPositions, count: 2, usd: 40},
+	}
+	for _, tt := range aggregates {
+		if tt.got.Count != tt.count || !closeTo(tt.got.BalanceUSD, tt.usd) {
+			t.Errorf("%s = %+v, want %d worth %v", tt.name, tt.got, tt.count, tt.usd)
+		}
+	}
+
+	// The caller's portfolio is left alone
+	if len(req.TokenBalances.ByToken) != 6 || len(req.AppBalances.ByApp[1].Balances) != 3 {
+		t.Errorf("compact modified its input: %+v", req)
+	}
+}
+
+func TestCompactKeepsSmallPortfolios(t *testing.T) {
+	req := api.RiskRequest{TokenBalances: api.TokenBalances{ByToken: []api.TokenBalance{holding("ETH", 10), holding("USDC", 5)}}}
+	compacted, compaction := compact(req, 1, DefaultTopN)
+	if len(compacted.TokenBalances.ByToken) != 2 || compaction.Dust.Count != 0 || compaction.TailHoldings.Count != 0 {
+		t.Errorf("compact = %+v, %+v; want the portfolio untouched", compacted.TokenBalances, compaction)
+	}
+	if compacted.AppBalances.ByApp != nil {
+		t.Errorf("apps = %+v, want none", compacted.AppBalances.ByApp)
+	}
+}
+
+func TestBuildHalvesUnderBudget(t *testing.T) {
+	library, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	const holdings = 40
+	req := api.RiskRequest{Address: sampleWallet, PromptVersion: DefaultVersion}
+	for i := range holdings {
+		req.TokenBalances.ByToken = append(req.TokenBalances.ByToken, holding(fmt.Sprintf("TKN%02d", i), float64(1000-i)))
+	}
+
+	build := func(topN, budget int) *api.Prompt {
+		t.Helper()
+		builder, err := NewBuilder(library, nil, CompactionConfig{TopN: topN, TokenBudget: budget})
+		if err != nil {
+			t.Fatalf("NewBuilder: %v", err)
+		}
+		prompt, err := builder.Build(req)
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+		return prompt
+	}
+	// sizes holds the prompt size for each number of holdings kept
+	sizes := make(map[int]int)
+	for _, topN := range []int{50, 25, 12, 6, 3, 1} {
+		sizes[topN] = build(topN, math.MaxInt32).EstimatedTokens
+	}
+
+	tests := []struct {
+		budget int
+		kept   int
+	}{
+		{budget: sizes[50], kept: holdings},
+		{budget: sizes[50] - 1, kept: 25},
+		{budget: sizes[12], kept: 12},
+		{budget: sizes[3] + 1, kept: 3},
+		// Over budget even with one holding kept: sent anyway
+		{budget: 1, kept: 1},
+	}
+	for _, tt := range tests {
+		prompt := build(50, tt.budget)
+		if tt.budget > 1 && prompt.EstimatedTokens > tt.budget {
+			t.Errorf("budget %d: prompt of ~%d tokens", tt.budget, prompt.EstimatedTokens)
+		}
+		user := prompt.Messages[len(prompt.Messages)-1].Content
+		tail := fmt.Sprintf("- %d smaller holdings", holdings-tt.kept)
+		if tt.kept == holdings {
+			tail = "smaller holdings"
+		}
+		if strings.Contains(user, tail) != (tt.kept < holdings) {
+			t.Errorf("budget %d: want %d holdings kept, user prompt:\n%s", tt.budget, tt.kept, user)
+		}
+		if last := fmt.Sprintf("TKN%02d", tt.kept-1); !strings.Contains(user, last) {
+			t.Errorf("budget %d: %s missing from the prompt", tt.budget, last)
+		}
+		if next := fmt.Sprintf("TKN%02d", tt.kept); strings.Contains(user, next) {
+			t.Errorf("budget %d: %s should have been left out", tt.budget, next)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package prompts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// funcs are the helpers available to prompt templates
+var funcs = template.FuncMap{
+	"usd":   usd,
+	"pct":   pct,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// usd formats a dollar amount with thousands separators, e.g. $12,345.67
+func usd(value float64) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	whole, frac, _ := strings.Cut(strconv.FormatFloat(value, 'f', 2, 64), ".")
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return sign + "$" + grouped.String() + "." + frac
+}
+
+// pct formats a ratio as a percentage, e.g. 0.1234 as 12.3%
+func pct(ratio float64) string {
+	return fmt.Sprintf("%.1f%%", ratio*100)
+}
@@ -0,0 +1,309 @@
+// Package prompts renders versioned, file-backed prompt templates for the
+// LLM risk engines and splits traffic between template versions for A/B
+// testing.
+package prompts
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"dex-analyzer/internal/api"
+	"dex-analyzer/internal/risk"
+)
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// DefaultVersion is the template served when no variants are configured
+const DefaultVersion = "v1"
+
+// Template files are named <version>.tmpl and define a "system" and a "user"
+// template. Risk profiles are shared by every version.
+const (
+	templateExt  = ".tmpl"
+	profilesFile = "profiles.json"
+)
+
+// Profile is a named set of risk-profile variables exposed to templates
+type Profile struct {
+	Name string
+	Vars map[string]string
+}
+
+// Library holds every template version and risk profile of a directory
+type Library struct {
+	templates      map[string]*template.Template
+	profiles       map[string]map[string]string
+	defaultProfile string
+}
+
+// Load reads templates and profiles from dir, or the bundled set when dir is
+// empty
+func Load(dir string) (*Library, error) {
+	var fsys fs.FS
+	if dir == "" {
+		sub, err := fs.Sub(defaultTemplates, "templates")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open bundled prompts: %w", err)
+		}
+		fsys = sub
+	} else {
+		fsys = os.DirFS(dir)
+	}
+
+	profilesData, err := fs.ReadFile(fsys, profilesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt profiles: %w", err)
+	}
+	var profiles struct {
+		Default  string                       `json:"default"`
+		Profiles map[string]map[string]string `json:"profiles"`
+	}
+	if err := json.Unmarshal(profilesData, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse prompt profiles: %w", err)
+	}
+	if _, ok := profiles.Profiles[profiles.Default]; !ok {
+		return nil, fmt.Errorf("default risk profile %q is not defined", profiles.Default)
+	}
+
+	names, err := fs.Glob(fsys, "*"+templateExt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt templates: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no %s prompt templates found", templateExt)
+	}
+
+	library := &Library{
+		templates:      make(map[string]*template.Template),
+		profiles:       profiles.Profiles,
+		defaultProfile: profiles.Default,
+	}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template %s: %w", name, err)
+		}
+		version := strings.TrimSuffix(path.Base(name), templateExt)
+		tmpl, err := template.New(version).Option("missingkey=error").Funcs(funcs).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+		}
+		for _, section := range []string{"system", "user"} {
+			if tmpl.Lookup(section) == nil {
+				return nil, fmt.Errorf("prompt template %s does not define %q", name, section)
+			}
+		}
+		library.templates[version] = tmpl
+	}
+
+	return library, nil
+}
+
+// Versions lists the loaded template versions in sorted order
+func (l *Library) Versions() []string {
+	versions := make([]string, 0, len(l.templates))
+	for version := range l.templates {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// Profiles lists the risk profile names in sorted order
+func (l *Library) Profiles() []string {
+	profiles := make([]string, 0, len(l.profiles))
+	for name := range l.profiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// Variant is a template version and its relative share of traffic
+type Variant struct {
+	Version string
+	Weight  int
+}
+
+// ParseVariants parses a traffic split such as "v1:80,v2:20". A version
+// without a weight gets weight 1.
+func ParseVariants(value string) ([]Variant, error) {
+	var variants []Variant
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		variant := Variant{Version: part, Weight: 1}
+		if version, weight, ok := strings.Cut(part, ":"); ok {
+			w, err := strconv.Atoi(strings.TrimSpace(weight))
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("invalid weight %q for prompt version %q", weight, version)
+			}
+			variant = Variant{Version: strings.TrimSpace(version), Weight: w}
+		}
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+// Builder is an api.PromptBuilder that renders templates from a Library
+type Builder struct {
+	library     *Library
+	variants    []Variant
+	totalWeight int
+	compaction  CompactionConfig
+}
+
+// NewBuilder creates a builder splitting traffic between variants, or serving
+// DefaultVersion when there are none. Portfolios are compacted to fit the
+// compaction budget before rendering.
+func NewBuilder(library *Library, variants []Variant, compaction CompactionConfig) (*Builder, error) {
+	if len(variants) == 0 {
+		variants = []Variant{{Version: DefaultVersion, Weight: 1}}
+	}
+	if compaction.TokenBudget <= 0 {
+		compaction.TokenBudget = DefaultTokenBudget
+	}
+	if compaction.DustUSD <= 0 {
+		compaction.DustUSD = DefaultDustUSD
+	}
+	if compaction.TopN <= 0 {
+		compaction.TopN = DefaultTopN
+	}
+
+	b := &Builder{library: library, variants: variants, compaction: compaction}
+	for _, variant := range variants {
+		if _, ok := library.templates[variant.Version]; !ok {
+			return nil, fmt.Errorf("unknown prompt version %q (available: %s)", variant.Version, strings.Join(library.Versions(), ", "))
+		}
+		b.totalWeight += variant.Weight
+	}
+	return b, nil
+}
+
+// data is what templates are executed with
+type data struct {
+	Version string
+	Tool    string
+	Profile Profile
+	Summary Summary
+	// Compaction reports the dust and tail left out of Summary and Portfolio
+	Compaction Compaction
+	// Portfolio is the compacted portfolio as JSON
+	Portfolio string
+}
+
+// Build renders the system and user messages for a portfolio. An explicit
+// req.PromptVersion wins; otherwise the variant is picked from the wallet
+// address so a wallet always sees the same version.
+func (b *Builder) Build(req api.RiskRequest) (*api.Prompt, error) {
+	if err := b.Validate(req.RiskProfile, req.PromptVersion); err != nil {
+		return nil, err
+	}
+
+	// Picked versions and the default profile were checked when loading
+	version := req.PromptVersion
+	if version == "" {
+		version = b.pick(req.Address)
+	}
+	tmpl := b.library.templates[version]
+
+	profileName := req.RiskProfile
+	if profileName == "" {
+		profileName = b.library.defaultProfile
+	}
+	vars := b.library.profiles[profileName]
+
+	// Shrink the number of holdings and positions kept until the rendered
+	// prompt fits the token budget. Metrics always cover the whole portfolio.
+	metrics := risk.ComputeMetrics(req)
+	profile := Profile{Name: profileName, Vars: vars}
+	topN := b.compaction.TopN
+	for {
+		compacted, compaction := compact(req, b.compaction.DustUSD, topN)
+		prompt, err := render(tmpl, version, data{
+			Version:    version,
+			Tool:       "analyze_portfolio_risk",
+			Profile:    profile,
+			Summary:    summarize(compacted, metrics),
+			Compaction: compaction,
+		}, compacted)
+		if err != nil {
+			return nil, err
+		}
+
+		if prompt.EstimatedTokens <= b.compaction.TokenBudget || topN == 1 {
+			if prompt.EstimatedTokens > b.compaction.TokenBudget {
+				log.Printf("Prompt %s for %s is ~%d tokens, over the %d token budget even with one holding kept",
+					version, req.Address, prompt.EstimatedTokens, b.compaction.TokenBudget)
+			}
+			return prompt, nil
+		}
+		topN /= 2
+	}
+}
+
+// Validate checks that a requested risk profile and template version exist.
+// Empty values select the defaults. Unknown values are client errors.
+func (b *Builder) Validate(riskProfile, version string) error {
+	if version != "" {
+		if _, ok := b.library.templates[version]; !ok {
+			return fmt.Errorf("%w: unknown prompt version %q (available: %s)", api.ErrInvalidRequest, version, strings.Join(b.library.Versions(), ", "))
+		}
+	}
+	if riskProfile != "" {
+		if _, ok := b.library.profiles[riskProfile]; !ok {
+			return fmt.Errorf("%w: unknown risk profile %q (available: %s)", api.ErrInvalidRequest, riskProfile, strings.Join(b.library.Profiles(), ", "))
+		}
+	}
+	return nil
+}
+
+// render executes the system and user templates
+func render(tmpl *template.Template, version string, d data, portfolio api.RiskRequest) (*api.Prompt, error) {
+	portfolioJSON, err := json.Marshal(portfolio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal riskRequest: %w", err)
+	}
+	d.Portfolio = string(portfolioJSON)
+
+	prompt := &api.Prompt{Version: version}
+	for _, section := range []string{"system", "user"} {
+		var content strings.Builder
+		if err := tmpl.ExecuteTemplate(&content, section, d); err != nil {
+			return nil, fmt.Errorf("failed to render %s prompt of %s: %w", section, version, err)
+		}
+		prompt.Messages = append(prompt.Messages, api.ChatMessage{
+			Role:    section,
+			Content: strings.TrimSpace(content.String()),
+		})
+	}
+	prompt.EstimatedTokens = EstimateTokens(prompt.Messages)
+	return prompt, nil
+}
+
+// pick deterministically maps an address onto the weighted variants
+func (b *Builder) pick(address string) string {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(address)))
+	n := int(h.Sum32() % uint32(b.totalWeight))
+	for _, variant := range b.variants {
+		if n < variant.Weight {
+			return variant.Version
+		}
+		n -= variant.Weight
+	}
+	return b.variants[len(b.variants)-1].Version
+}
@@ -0,0 +1,46 @@
+package prompts
+
+import (
+	"errors"
+	"testing"
+
+	"dex-analyzer/internal/api"
+)
+
+func TestBuilderRejectsUnknownOptions(t *testing.T) {
+	library, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	builder, err := NewBuilder(library, nil, CompactionConfig{})
+	if err != nil {
+		t.Fatalf("NewBuilder: %v", err)
+	}
+
+	tests := []struct {
+		profile, version string
+		valid            bool
+	}{
+		{valid: true},
+		{profile: "conservative", version: "v2", valid: true},
+		{profile: "bogus"},
+		{version: "v9"},
+	}
+	for _, tt := range tests {
+		err := builder.Validate(tt.profile, tt.version)
+		if tt.valid {
+			if err != nil {
+				t.Errorf("Validate(%q, %q) = %v, want nil", tt.profile, tt.version, err)
+			}
+			continue
+		}
+		if !errors.Is(err, api.ErrInvalidRequest) {
+			t.Errorf("Validate(%q, %q) = %v, want ErrInvalidRequest", tt.profile, tt.version, err)
+		}
+
+		req := api.RiskRequest{Address: "0x1111111111111111111111111111111111111111", RiskProfile: tt.profile, PromptVersion: tt.version}
+		if _, err := builder.Build(req); !errors.Is(err, api.ErrInvalidRequest) {
+			t.Errorf("Build with %q, %q = %v, want ErrInvalidRequest", tt.profile, tt.version, err)
+		}
+	}
+}
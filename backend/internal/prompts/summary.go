@@ -0,0 +1,97 @@
+package prompts
+
+import (
+	"sort"
+	"strings"
+
+	"dex-analyzer/internal/api"
+	"dex-analyzer/internal/risk"
+)
+
+// Summary is the condensed view of a portfolio that templates render
+type Summary struct {
+	Address   string
+	Metrics   risk.Metrics
+	Holdings  []Holding
+	Positions []Position
+	// Truncated is set when the portfolio exceeded the fetch cap
+	Truncated bool
+}
+
+// Holding is a wallet token, with its share of total assets
+type Holding struct {
+	Symbol     string
+	Network    string
+	BalanceUSD float64
+	Share      float64
+}
+
+// Position is a DeFi contract position
+type Position struct {
+	App        string
+	Label      string
+	Network    string
+	BalanceUSD float64
+	Tokens     []PositionToken
+}
+
+// PositionToken is a supplied, borrowed, locked or claimable token of a position
+type PositionToken struct {
+	MetaType   string
+	Symbol     string
+	BalanceUSD float64
+}
+
+// Summarize condenses a portfolio, ordering holdings and positions by USD value
+func Summarize(req api.RiskRequest) Summary {
+	return summarize(req, risk.ComputeMetrics(req))
+}
+
+// summarize lists the holdings and positions of req against metrics that may
+// have been computed on the portfolio before compaction
+func summarize(req api.RiskRequest, metrics risk.Metrics) Summary {
+	summary := Summary{
+		Address:   req.Address,
+		Metrics:   metrics,
+		Truncated: req.TokenBalances.Truncated || req.AppBalances.Truncated,
+	}
+
+	for _, token := range req.TokenBalances.ByToken {
+		holding := Holding{
+			Symbol:     token.Symbol,
+			Network:    token.Network.Name,
+			BalanceUSD: token.BalanceUSD,
+		}
+		if summary.Metrics.TotalAssets > 0 {
+			holding.Share = token.BalanceUSD / summary.Metrics.TotalAssets
+		}
+		summary.Holdings = append(summary.Holdings, holding)
+	}
+	sort.SliceStable(summary.Holdings, func(i, j int) bool {
+		return summary.Holdings[i].BalanceUSD > summary.Holdings[j].BalanceUSD
+	})
+
+	for _, appBalance := range req.AppBalances.ByApp {
+		for _, contractPos := range appBalance.Balances {
+			position := Position{
+				App:        appBalance.App.DisplayName,
+				Label:      contractPos.DisplayProps.Label,
+				Network:    appBalance.Network.Name,
+				BalanceUSD: contractPos.BalanceUSD,
+			}
+			for _, tokenPos := range contractPos.Tokens {
+				position.Tokens = append(position.Tokens, PositionToken{
+					MetaType:   strings.ToLower(tokenPos.MetaType),
+					Symbol:     tokenPos.Token.Symbol,
+					BalanceUSD: tokenPos.Token.BalanceUSD,
+				})
+			}
+			summary.Positions = append(summary.Positions, position)
+		}
+	}
+	sort.SliceStable(summary.Positions, func(i, j int) bool {
+		return summary.Positions[i].BalanceUSD > summary.Positions[j].BalanceUSD
+	})
+
+	return summary
+}
@@ -0,0 +1,145 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"dex-analyzer/internal/api"
+)
+
+// Thresholds and weights from RISK_RULES in agents/risk_advisor.py
+const (
+	HHIMediumThreshold = 2500.0
+	HHIHighThreshold   = 5000.0
+
+	LeverageMediumThreshold = 0.2
+	LeverageHighThreshold   = 0.5
+
+	IlliquidityMediumThreshold = 0.3
+	IlliquidityHighThreshold   = 0.5
+
+	concentrationHighWeight   = 0.4
+	concentrationMediumWeight = 0.2
+	leverageHighWeight        = 0.3
+	leverageMediumWeight      = 0.15
+	illiquidityHighWeight     = 0.25
+	illiquidityMediumWeight   = 0.1
+
+	maxRiskScore = 1.0
+)
+
+// Reasoning strings emitted by the recommend rules
+const (
+	reasonConcentration = "High concentration risk - consider diversifying into stablecoins"
+	reasonLeverageBTC   = "High leverage detected - consider hedging with volatile assets like BTC"
+	reasonLeverageETH   = "High leverage detected - consider hedging with volatile assets like ETH"
+	reasonIlliquidity   = "High illiquidity from locked positions - add more liquid assets"
+	reasonBalanced      = "No specific recommendations - portfolio is balanced"
+	reasonDefault       = "Portfolio appears well balanced with low risk factors."
+)
+
+// Engine scores portfolios with the deterministic MeTTa rule set
+type Engine struct{}
+
+// NewEngine creates a native rule-based risk engine
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// Analyze computes the risk score and recommendations for a portfolio
+func (e *Engine) Analyze(ctx context.Context, req api.RiskRequest) (*api.RiskResponse, error) {
+	if req.Address == "" {
+		return nil, fmt.Errorf("invalid risk request: address is required")
+	}
+
+	m := ComputeMetrics(req)
+	tokens, reasoning := recommend(m)
+
+	return &api.RiskResponse{
+		RecommendedTokens: tokens,
+		RiskScore:         Score(m),
+		Reasoning:         reasoning,
+		Factors:           BuildFactors(m),
+	}, nil
+}
+
+// Score mirrors the risk-score rule: the sum of the concentration, leverage
+// and illiquidity factors capped at 1.0
+func Score(m Metrics) float64 {
+	total := ConcentrationFactor(m.HHI) + LeverageFactor(m.LeverageRatio) + IlliquidityFactor(m.IlliquidityRatio)
+	return math.Min(maxRiskScore, total)
+}
+
+// ConcentrationFactor mirrors risk-factor-concentration
+func ConcentrationFactor(hhi float64) float64 {
+	switch {
+	case hhi > HHIHighThreshold:
+		return concentrationHighWeight
+	case hhi > HHIMediumThreshold:
+		return concentrationMediumWeight
+	default:
+		return 0
+	}
+}
+
+// LeverageFactor mirrors risk-factor-leverage
+func LeverageFactor(ratio float64) float64 {
+	switch {
+	case ratio > LeverageHighThreshold:
+		return leverageHighWeight
+	case ratio > LeverageMediumThreshold:
+		return leverageMediumWeight
+	default:
+		return 0
+	}
+}
+
+// IlliquidityFactor mirrors risk-factor-illiquidity
+func IlliquidityFactor(ratio float64) float64 {
+	switch {
+	case ratio > IlliquidityHighThreshold:
+		return illiquidityHighWeight
+	case ratio > IlliquidityMediumThreshold:
+		return illiquidityMediumWeight
+	default:
+		return 0
+	}
+}
+
+// recommend mirrors the recommend rules. Token symbols are deduplicated while
+// every matching reason is kept.
+func recommend(m Metrics) ([]string, []string) {
+	tokens := make([]string, 0)
+	reasoning := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add := func(token, reason string) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+		reasoning = append(reasoning, reason)
+	}
+
+	if m.HHI > HHIMediumThreshold {
+		add("USDC", reasonConcentration)
+	}
+	if m.LeverageRatio > LeverageMediumThreshold {
+		add("BTC", reasonLeverageBTC)
+		add("ETH", reasonLeverageETH)
+	}
+	if m.IlliquidityRatio > IlliquidityMediumThreshold {
+		add("USDC", reasonIlliquidity)
+	}
+
+	if m.HHI < HHIMediumThreshold && m.LeverageRatio < LeverageMediumThreshold && m.IlliquidityRatio < IlliquidityMediumThreshold {
+		reasoning = append(reasoning, reasonBalanced)
+	}
+
+	if len(reasoning) == 0 {
+		reasoning = append(reasoning, reasonDefault)
+	}
+
+	return tokens, reasoning
+}
@@ -0,0 +1,154 @@
+package risk
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"dex-analyzer/internal/api"
+)
+
+const sampleWallet = "0x1111111111111111111111111111111111111111"
+
+func TestFactorBandEdges(t *testing.T) {
+	// Like the MeTTa rules, a metric exactly on a threshold stays in the band
+	// below it
+	tests := []struct {
+		name   string
+		factor func(float64) float64
+		metric float64
+		want   float64
+		band   string
+	}{
+		{name: FactorConcentration, factor: ConcentrationFactor, metric: HHIMediumThreshold, want: 0, band: BandLow},
+		{name: FactorConcentration, factor: ConcentrationFactor, metric: HHIMediumThreshold + 0.01, want: concentrationMediumWeight, band: BandMedium},
+		{name: FactorConcentration, factor: ConcentrationFactor, metric: HHIHighThreshold, want: concentrationMediumWeight, band: BandMedium},
+		{name: FactorConcentration, factor: ConcentrationFactor, metric: HHIHighThreshold + 0.01, want: concentrationHighWeight, band: BandHigh},
+		{name: FactorLeverage, factor: LeverageFactor, metric: LeverageMediumThreshold, want: 0, band: BandLow},
+		{name: FactorLeverage, factor: LeverageFactor, metric: LeverageMediumThreshold + 0.001, want: leverageMediumWeight, band: BandMedium},
+		{name: FactorLeverage, factor: LeverageFactor, metric: LeverageHighThreshold, want: leverageMediumWeight, band: BandMedium},
+		{name: FactorLeverage, factor: LeverageFactor, metric: LeverageHighThreshold + 0.001, want: leverageHighWeight, band: BandHigh},
+		{name: FactorIlliquidity, factor: IlliquidityFactor, metric: IlliquidityMediumThreshold, want: 0, band: BandLow},
+		{name: FactorIlliquidity, factor: IlliquidityFactor, metric: IlliquidityMediumThreshold + 0.001, want: illiquidityMediumWeight, band: BandMedium},
+		{name: FactorIlliquidity, factor: IlliquidityFactor, metric: IlliquidityHighThreshold, want: illiquidityMediumWeight, band: BandMedium},
+		{name: FactorIlliquidity, factor: IlliquidityFactor, metric: IlliquidityHighThreshold + 0.001, want: illiquidityHighWeight, band: BandHigh},
+	}
+	for _, tt := range tests {
+		if got := tt.factor(tt.metric); got != tt.want {
+			t.Errorf("%s factor at %v = %v, want %v", tt.name, tt.metric, got, tt.want)
+		}
+
+		var m Metrics
+		switch tt.name {
+		case FactorConcentration:
+			m.HHI = tt.metric
+		case FactorLeverage:
+			m.LeverageRatio = tt.metric
+		case FactorIlliquidity:
+			m.IlliquidityRatio = tt.metric
+		}
+		for _, factor := range BuildFactors(m) {
+			if factor.Name != tt.name {
+				continue
+			}
+			if factor.Band != tt.band || factor.Contribution != tt.want {
+				t.Errorf("%s at %v is %s contributing %v, want %s contributing %v",
+					tt.name, tt.metric, factor.Band, factor.Contribution, tt.band, tt.want)
+			}
+		}
+	}
+}
+
+func TestScoreCap(t *testing.T) {
+	highest := Metrics{HHI: 10000, LeverageRatio: 1, IlliquidityRatio: 1}
+	want := concentrationHighWeight + leverageHighWeight + illiquidityHighWeight
+	if got := Score(highest); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Score(%+v) = %v, want the sum of the high weights %v", highest, got, want)
+	}
+	// The high weights sum to 0.95, so the 1.0 cap of the MeTTa rule never
+	// applies with the current weights
+	if want > maxRiskScore {
+		t.Errorf("high weights sum to %v, above the %v cap", want, maxRiskScore)
+	}
+	if got := Score(Metrics{}); got != 0 {
+		t.Errorf("Score of an empty portfolio = %v, want 0", got)
+	}
+}
+
+func TestAnalyzeWithoutAssets(t *testing.T) {
+	// Only debt: no assets to divide by, so every ratio stays at zero
+	borrowed := api.RiskRequest{
+		Address: sampleWallet,
+		AppBalances: api.AppBalances{ByApp: []api.AppBalance{{
+			App: api.App{DisplayName: "Aave V3", Slug: "aave-v3"},
+			Balances: []api.ContractPosition{{Tokens: []api.TokenPosition{
+				{MetaType: "BORROWED", Token: api.TokenBalance{Symbol: "USDC", BalanceUSD: 500}},
+			}}},
+		}}},
+	}
+
+	for name, req := range map[string]api.RiskRequest{
+		"empty":    {Address: sampleWallet},
+		"borrowed": borrowed,
+	} {
+		m := ComputeMetrics(req)
+		if m.TotalAssets != 0 || m.HHI != 0 || m.LeverageRatio != 0 || m.IlliquidityRatio != 0 || m.StablecoinShare != 0 {
+			t.Errorf("%s: metrics = %+v, want zero ratios", name, m)
+		}
+
+		resp, err := NewEngine().Analyze(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%s: Analyze: %v", name, err)
+		}
+		if resp.RiskScore != 0 || len(resp.RecommendedTokens) != 0 {
+			t.Errorf("%s: score %v recommending %v, want 0 recommending nothing", name, resp.RiskScore, resp.RecommendedTokens)
+		}
+		if !reflect.DeepEqual(resp.Reasoning, []string{reasonBalanced}) {
+			t.Errorf("%s: reasoning = %q, want the balanced reason", name, resp.Reasoning)
+		}
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	tests := []struct {
+		name      string
+		metrics   Metrics
+		tokens    []string
+		reasoning []string
+	}{
+		{
+			name:      "balanced",
+			metrics:   Metrics{HHI: 1000, LeverageRatio: 0.1, IlliquidityRatio: 0.1},
+			tokens:    []string{},
+			reasoning: []string{reasonBalanced},
+		},
+		{
+			// Neither above the threshold nor below it, as in the MeTTa rules
+			name:      "on the medium threshold",
+			metrics:   Metrics{HHI: HHIMediumThreshold},
+			tokens:    []string{},
+			reasoning: []string{reasonDefault},
+		},
+		{
+			name:      "leveraged",
+			metrics:   Metrics{LeverageRatio: 0.3},
+			tokens:    []string{"BTC", "ETH"},
+			reasoning: []string{reasonLeverageBTC, reasonLeverageETH},
+		},
+		{
+			// The Python agent lists USDC once per matching rule; the native
+			// engine lists it once but keeps both reasons
+			name:      "concentrated and illiquid",
+			metrics:   Metrics{HHI: 6000, IlliquidityRatio: 0.6},
+			tokens:    []string{"USDC"},
+			reasoning: []string{reasonConcentration, reasonIlliquidity},
+		},
+	}
+	for _, tt := range tests {
+		tokens, reasoning := recommend(tt.metrics)
+		if !reflect.DeepEqual(tokens, tt.tokens) || !reflect.DeepEqual(reasoning, tt.reasoning) {
+			t.Errorf("%s: recommend = %q because %q, want %q because %q", tt.name, tokens, reasoning, tt.tokens, tt.reasoning)
+		}
+	}
+}
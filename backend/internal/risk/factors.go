@@ -0,0 +1,122 @@
+package risk
+
+import (
+	"strings"
+
+	"dex-analyzer/internal/api"
+)
+
+// Names of the factors reported in RiskResponse.Factors
+const (
+	FactorConcentration   = "concentration"
+	FactorLeverage        = "leverage"
+	FactorIlliquidity     = "illiquidity"
+	FactorStablecoinShare = "stablecoin_share"
+)
+
+// Threshold bands a factor metric can fall into
+const (
+	BandLow    = "low"
+	BandMedium = "medium"
+	BandHigh   = "high"
+)
+
+// Stablecoin share bands. The MeTTa rules have no stablecoin factor, so the
+// share is reported for context and never contributes to the score.
+const (
+	StablecoinMediumThreshold = 0.3
+	StablecoinHighThreshold   = 0.1
+)
+
+// stablecoins are the symbols counted towards the stablecoin share
+var stablecoins = map[string]bool{
+	"USDC":   true,
+	"USDBC":  true,
+	"USDT":   true,
+	"DAI":    true,
+	"USDS":   true,
+	"USDE":   true,
+	"FRAX":   true,
+	"LUSD":   true,
+	"GHO":    true,
+	"CRVUSD": true,
+	"PYUSD":  true,
+	"TUSD":   true,
+	"USDP":   true,
+}
+
+// IsStablecoin reports whether symbol is a known USD stablecoin
+func IsStablecoin(symbol string) bool {
+	return stablecoins[strings.ToUpper(symbol)]
+}
+
+// Factors implements api.FactorAnalyzer
+func (e *Engine) Factors(req api.RiskRequest) []api.RiskFactor {
+	return BuildFactors(ComputeMetrics(req))
+}
+
+// BuildFactors breaks the risk score down into its individual factors
+func BuildFactors(m Metrics) []api.RiskFactor {
+	return []api.RiskFactor{
+		{
+			Name:            FactorConcentration,
+			Metric:          m.HHI,
+			Band:            bandAbove(m.HHI, HHIMediumThreshold, HHIHighThreshold),
+			MediumThreshold: HHIMediumThreshold,
+			HighThreshold:   HHIHighThreshold,
+			Contribution:    ConcentrationFactor(m.HHI),
+			Description:     "Herfindahl-Hirschman Index of holdings (0-10000)",
+		},
+		{
+			Name:            FactorLeverage,
+			Metric:          m.LeverageRatio,
+			Band:            bandAbove(m.LeverageRatio, LeverageMediumThreshold, LeverageHighThreshold),
+			MediumThreshold: LeverageMediumThreshold,
+			HighThreshold:   LeverageHighThreshold,
+			Contribution:    LeverageFactor(m.LeverageRatio),
+			Description:     "Borrowed value divided by total assets",
+		},
+		{
+			Name:            FactorIlliquidity,
+			Metric:          m.IlliquidityRatio,
+			Band:            bandAbove(m.IlliquidityRatio, IlliquidityMediumThreshold, IlliquidityHighThreshold),
+			MediumThreshold: IlliquidityMediumThreshold,
+			HighThreshold:   IlliquidityHighThreshold,
+			Contribution:    IlliquidityFactor(m.IlliquidityRatio),
+			Description:     "Locked value divided by total assets",
+		},
+		{
+			Name:            FactorStablecoinShare,
+			Metric:          m.StablecoinShare,
+			Band:            bandBelow(m.StablecoinShare, StablecoinMediumThreshold, StablecoinHighThreshold),
+			MediumThreshold: StablecoinMediumThreshold,
+			HighThreshold:   StablecoinHighThreshold,
+			Contribution:    0,
+			Description:     "Stablecoin value divided by total assets; informational, bands apply below the thresholds",
+		},
+	}
+}
+
+// bandAbove classifies metrics where higher values are riskier
+func bandAbove(metric, medium, high float64) string {
+	switch {
+	case metric > high:
+		return BandHigh
+	case metric > medium:
+		return BandMedium
+	default:
+		return BandLow
+	}
+}
+
+// bandBelow classifies metrics where lower values are riskier
+func bandBelow(metric, medium, high float64) string {
+	switch {
+	case metric < high:
+		return BandHigh
+	case metric < medium:
+		return BandMedium
+	default:
+		return BandLow
+	}
+}
@@ -0,0 +1,89 @@
+// Package risk is a native Go port of the MeTTa risk rules used by the
+// Python risk_advisor agent. It scores a portfolio deterministically and
+// without any network access.
+package risk
+
+import (
+	"strings"
+
+	"dex-analyzer/internal/api"
+)
+
+// Position meta types reported by Zapper for contract position tokens
+const (
+	MetaTypeSupplied  = "supplied"
+	MetaTypeBorrowed  = "borrowed"
+	MetaTypeLocked    = "locked"
+	MetaTypeClaimable = "claimable"
+)
+
+// Metrics holds the raw portfolio figures the risk factors are derived from
+type Metrics struct {
+	TotalAssets      float64 `json:"total_assets"`
+	TotalLiabilities float64 `json:"total_liabilities"`
+	TotalLocked      float64 `json:"total_locked"`
+	NetWorth         float64 `json:"net_worth"`
+	HHI              float64 `json:"hhi"`
+	LeverageRatio    float64 `json:"leverage_ratio"`
+	IlliquidityRatio float64 `json:"illiquidity_ratio"`
+	StablecoinShare  float64 `json:"stablecoin_share"`
+}
+
+// ComputeMetrics mirrors the get-all-holdings, total-*, hhi, leverage-ratio and
+// illiquidity-ratio rules. Wallet tokens plus supplied, locked and claimable
+// position tokens count as assets; borrowed position tokens are liabilities.
+func ComputeMetrics(req api.RiskRequest) Metrics {
+	var holdings []float64
+	var stablecoinValue float64
+	var m Metrics
+
+	for _, token := range req.TokenBalances.ByToken {
+		holdings = append(holdings, token.BalanceUSD)
+		if IsStablecoin(token.Symbol) {
+			stablecoinValue += token.BalanceUSD
+		}
+	}
+
+	for _, appBalance := range req.AppBalances.ByApp {
+		for _, contractPos := range appBalance.Balances {
+			for _, tokenPos := range contractPos.Tokens {
+				value := tokenPos.Token.BalanceUSD
+				switch strings.ToLower(tokenPos.MetaType) {
+				case MetaTypeSupplied, MetaTypeClaimable:
+					holdings = append(holdings, value)
+				case MetaTypeLocked:
+					holdings = append(holdings, value)
+					m.TotalLocked += value
+				case MetaTypeBorrowed:
+					m.TotalLiabilities += value
+					continue
+				default:
+					continue
+				}
+				if IsStablecoin(tokenPos.Token.Symbol) {
+					stablecoinValue += value
+				}
+			}
+		}
+	}
+
+	for _, v := range holdings {
+		m.TotalAssets += v
+	}
+	m.NetWorth = m.TotalAssets - m.TotalLiabilities
+
+	if m.TotalAssets == 0 {
+		return m
+	}
+
+	for _, v := range holdings {
+		share := v / m.TotalAssets
+		m.HHI += share * share
+	}
+	m.HHI *= 10000
+	m.LeverageRatio = m.TotalLiabilities / m.TotalAssets
+	m.IlliquidityRatio = m.TotalLocked / m.TotalAssets
+	m.StablecoinShare = stablecoinValue / m.TotalAssets
+
+	return m
+}
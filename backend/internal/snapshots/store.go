@@ -0,0 +1,194 @@
+// Package snapshots is an embedded, file-backed api.SnapshotStore. Each
+// wallet gets a directory holding one JSON file per snapshot plus an
+// append-only index of snapshot summaries for history listings.
+package snapshots
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"dex-analyzer/internal/address"
+	"dex-analyzer/internal/api"
+)
+
+// DefaultDir is where snapshots are stored when no directory is configured
+const DefaultDir = "data/snapshots"
+
+// indexFile lists the summaries of a wallet's snapshots, one JSON object per line
+const indexFile = "index.jsonl"
+
+// Store keeps snapshots under <dir>/<address>/<id>.json
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open creates the snapshot directory if needed
+func Open(dir string) (*Store, error) {
+	if dir == "" {
+		dir = DefaultDir
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// NewID returns a time-ordered UUID
+func (s *Store) NewID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// Save writes the snapshot file and appends it to the wallet's index
+func (s *Store) Save(snapshot api.Snapshot) error {
+	if _, err := uuid.Parse(snapshot.ID); err != nil {
+		return fmt.Errorf("invalid snapshot ID %q", snapshot.ID)
+	}
+	walletDir, err := s.walletDir(snapshot.Address)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	summary, err := json.Marshal(snapshot.Summary())
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot summary: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(walletDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create wallet directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial
+	// snapshot behind an index entry
+	path := filepath.Join(walletDir, snapshot.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	index, err := os.OpenFile(filepath.Join(walletDir, indexFile), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot index: %w", err)
+	}
+	defer index.Close()
+	line := append(summary, '\n')
+	// Start a new line after an entry cut short by a crash
+	if info, err := index.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := index.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err := index.Write(line); err != nil {
+		return fmt.Errorf("failed to update snapshot index: %w", err)
+	}
+	return nil
+}
+
+// History reads the wallet's index, newest snapshot first. Unreadable index
+// lines are skipped.
+func (s *Store) History(address string, limit int) ([]api.SnapshotSummary, error) {
+	walletDir, err := s.walletDir(address)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := os.Open(filepath.Join(walletDir, indexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot index: %w", err)
+	}
+	defer index.Close()
+
+	var history []api.SnapshotSummary
+	scanner := bufio.NewScanner(index)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		// A line cut short by a crash must not hide the rest of the history
+		var summary api.SnapshotSummary
+		if err := json.Unmarshal(scanner.Bytes(), &summary); err != nil {
+			log.Printf("Skipping unreadable snapshot index entry of %s: %v", address, err)
+			continue
+		}
+		history = append(history, summary)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot index: %w", err)
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].CreatedAt.After(history[j].CreatedAt)
+	})
+	if limit > 0 && len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+// Get reads a snapshot file
+func (s *Store) Get(address, id string) (*api.Snapshot, error) {
+	// Only UUIDs are valid IDs, which also keeps id from escaping the directory
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, api.ErrSnapshotNotFound
+	}
+	walletDir, err := s.walletDir(address)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(walletDir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil, api.ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snapshot api.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// walletDir is the directory of a wallet, rejecting anything that is not a
+// canonical address so that each wallet maps to exactly one directory
+func (s *Store) walletDir(wallet string) (string, error) {
+	canonical, err := address.Parse(wallet)
+	if err != nil {
+		return "", fmt.Errorf("invalid wallet %q: %w", wallet, err)
+	}
+	if canonical != wallet {
+		return "", fmt.Errorf("wallet %q is not in canonical form %s", wallet, canonical)
+	}
+	return filepath.Join(s.dir, wallet), nil
+}
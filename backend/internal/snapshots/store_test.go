@@ -0,0 +1,153 @@
+package snapshots
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dex-analyzer/internal/api"
+)
+
+const sampleWallet = "0x1111111111111111111111111111111111111111"
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return store
+}
+
+// saveAt stores a snapshot of sampleWallet taken at createdAt with score
+func saveAt(t *testing.T, store *Store, createdAt time.Time, score float64) string {
+	t.Helper()
+	snapshot := api.Snapshot{
+		ID:        store.NewID(),
+		Address:   sampleWallet,
+		CreatedAt: createdAt,
+		Scope:     api.SnapshotScope{Chains: []int{8453}},
+		Request:   api.RiskRequest{Address: sampleWallet, TokenBalances: api.TokenBalances{TotalBalanceUSD: 100}},
+		Response:  api.RiskResponse{RiskScore: score},
+	}
+	if err := store.Save(snapshot); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return snapshot.ID
+}
+
+func TestStoreSaveAndGet(t *testing.T) {
+	store := openStore(t)
+	createdAt := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	id := saveAt(t, store, createdAt, 0.3)
+
+	snapshot, err := store.Get(sampleWallet, id)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if snapshot.ID != id || !snapshot.CreatedAt.Equal(createdAt) || snapshot.Response.RiskScore != 0.3 ||
+		snapshot.Request.TokenBalances.TotalBalanceUSD != 100 || len(snapshot.Scope.Chains) != 1 {
+		t.Errorf("Get = %+v, want the saved snapshot", snapshot)
+	}
+
+	tests := []struct {
+		name, wallet, id string
+	}{
+		{name: "unknown ID", wallet: sampleWallet, id: store.NewID()},
+		{name: "malformed ID", wallet: sampleWallet, id: "../" + id},
+		{name: "empty ID", wallet: sampleWallet, id: ""},
+		{name: "other wallet", wallet: "0x2222222222222222222222222222222222222222", id: id},
+	}
+	for _, tt := range tests {
+		if _, err := store.Get(tt.wallet, tt.id); !errors.Is(err, api.ErrSnapshotNotFound) {
+			t.Errorf("%s: Get = %v, want ErrSnapshotNotFound", tt.name, err)
+		}
+	}
+}
+
+func TestStoreRejectsNonCanonicalWallets(t *testing.T) {
+	store := openStore(t)
+	snapshot := api.Snapshot{ID: store.NewID(), Address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"}
+	if err := store.Save(snapshot); err == nil {
+		t.Error("Save accepted a checksummed address as a wallet directory")
+	}
+	if _, err := store.History("../etc", 0); err == nil {
+		t.Error("History accepted a path as a wallet")
+	}
+}
+
+func TestStoreHistory(t *testing.T) {
+	store := openStore(t)
+	if history, err := store.History(sampleWallet, 0); err != nil || history != nil {
+		t.Fatalf("History of a new wallet = %v, %v; want none", history, err)
+	}
+
+	// Saved out of order; history is sorted by creation time
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	second := saveAt(t, store, start.Add(time.Hour), 0.2)
+	first := saveAt(t, store, start, 0.1)
+	third := saveAt(t, store, start.Add(2*time.Hour), 0.3)
+
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{limit: 0, want: []string{third, second, first}},
+		{limit: 2, want: []string{third, second}},
+		{limit: 10, want: []string{third, second, first}},
+	}
+	for _, tt := range tests {
+		history, err := store.History(sampleWallet, tt.limit)
+		if err != nil {
+			t.Fatalf("History(%d): %v", tt.limit, err)
+		}
+		if len(history) != len(tt.want) {
+			t.Fatalf("History(%d) returned %d snapshots, want %d", tt.limit, len(history), len(tt.want))
+		}
+		for i, id := range tt.want {
+			if history[i].ID != id {
+				t.Errorf("History(%d)[%d] = %s, want %s", tt.limit, i, history[i].ID, id)
+			}
+		}
+	}
+
+	latest, _ := store.History(sampleWallet, 1)
+	if summary := latest[0]; summary.RiskScore != 0.3 || summary.TotalBalanceUSD != 100 || len(summary.Scope.Chains) != 1 {
+		t.Errorf("latest summary = %+v, want the third snapshot's score, value and scope", summary)
+	}
+}
+
+func TestStoreHistorySkipsCorruptIndexLines(t *testing.T) {
+	store := openStore(t)
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	first := saveAt(t, store, start, 0.1)
+
+	// A garbage line, then an entry cut short as if the process had crashed
+	// mid-append
+	index, err := os.OpenFile(filepath.Join(store.dir, sampleWallet, indexFile), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.WriteString("not json\n{\"id\": \"0197")
+	index.Close()
+
+	history, err := store.History(sampleWallet, 0)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 1 || history[0].ID != first {
+		t.Errorf("History = %+v, want only the intact entry", history)
+	}
+
+	// The next entry starts on a line of its own
+	second := saveAt(t, store, start.Add(time.Hour), 0.2)
+	history, err = store.History(sampleWallet, 0)
+	if err != nil {
+		t.Fatalf("History after save: %v", err)
+	}
+	if len(history) != 2 || history[0].ID != second || history[1].ID != first {
+		t.Errorf("History after save = %+v, want both intact entries", history)
+	}
+}
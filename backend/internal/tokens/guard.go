@@ -0,0 +1,166 @@
+package tokens
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dex-analyzer/internal/api"
+)
+
+// Sources a recommendation can be resolved from
+const (
+	SourceRegistry  = "registry"
+	SourcePortfolio = "portfolio"
+)
+
+// Guard grounds recommended token symbols against the registry and the
+// wallet's own holdings
+type Guard struct {
+	registry       *Registry
+	dropUnknown    bool
+	defaultNetwork string
+}
+
+// DefaultNetwork is the network assumed for empty portfolios unless
+// configured otherwise
+const DefaultNetwork = "base"
+
+// NewGuard creates a grounding guard. When dropUnknown is set, symbols that
+// cannot be resolved are removed from the recommendations; otherwise they are
+// kept and only flagged. Symbols the registry cannot check, because it has no
+// tokens on any of the wallet's networks, are always kept and flagged.
+// defaultNetwork is assumed for empty portfolios; none is when it is empty.
+func NewGuard(registry *Registry, dropUnknown bool, defaultNetwork string) *Guard {
+	return &Guard{
+		registry:       registry,
+		dropUnknown:    dropUnknown,
+		defaultNetwork: defaultNetwork,
+	}
+}
+
+// Ground implements api.Grounder. A symbol resolves when it maps to exactly
+// one contract on each of the wallet's networks it is found on; a symbol with
+// several candidate contracts on the same network is rejected as ambiguous.
+// Contracts the wallet holds take priority over the registry.
+func (g *Guard) Ground(req api.RiskRequest, resp *api.RiskResponse) {
+	networks := walletNetworks(req)
+	if len(networks) == 0 && g.defaultNetwork != "" {
+		networks = []string{g.defaultNetwork}
+	}
+	holdings := holdingsByNetwork(req)
+
+	recommended := make([]string, 0, len(resp.RecommendedTokens))
+	resp.ResolvedTokens = make([]api.ResolvedToken, 0)
+	resp.RejectedTokens = make([]api.RejectedToken, 0)
+
+	for _, symbol := range resp.RecommendedTokens {
+		resolved, reason, checked := g.resolve(symbol, networks, holdings)
+		if reason != "" {
+			resp.RejectedTokens = append(resp.RejectedTokens, api.RejectedToken{Symbol: symbol, Reason: reason})
+			if g.dropUnknown && checked {
+				continue
+			}
+		}
+		resp.ResolvedTokens = append(resp.ResolvedTokens, resolved...)
+		recommended = append(recommended, symbol)
+	}
+
+	resp.RecommendedTokens = recommended
+}
+
+// resolve maps a symbol to contracts on the given networks, returning a
+// rejection reason when it cannot be grounded unambiguously. checked is false
+// when an unresolved symbol could not be checked against the registry at all.
+func (g *Guard) resolve(symbol string, networks []string, holdings map[string][]api.TokenBalance) (resolved []api.ResolvedToken, reason string, checked bool) {
+	resolved = make([]api.ResolvedToken, 0)
+
+	for _, network := range networks {
+		checked = checked || g.registry.Covers(network)
+		// A contract the wallet already holds is what the symbol means to it
+		candidates := portfolioCandidates(symbol, holdings[network])
+		if len(candidates) == 0 {
+			for _, token := range g.registry.Lookup(symbol, network) {
+				candidates = append(candidates, api.ResolvedToken{
+					Symbol:   token.Symbol,
+					Address:  token.Address,
+					ChainID:  token.ChainID,
+					Network:  token.Network,
+					Decimals: token.Decimals,
+					Source:   SourceRegistry,
+				})
+			}
+		}
+
+		switch len(candidates) {
+		case 0:
+			continue
+		case 1:
+			resolved = append(resolved, candidates[0])
+		default:
+			return nil, fmt.Sprintf("ambiguous symbol on %s: %d candidate contracts", network, len(candidates)), true
+		}
+	}
+
+	switch {
+	case len(resolved) > 0:
+		return resolved, "", true
+	case len(networks) == 0:
+		return nil, "unverified: the wallet holds nothing to check the token against", false
+	case !checked:
+		return nil, fmt.Sprintf("unverified: the token registry has no tokens on %s", strings.Join(networks, ", ")), false
+	default:
+		return nil, fmt.Sprintf("unknown token on %s", strings.Join(networks, ", ")), true
+	}
+}
+
+// portfolioCandidates resolves a symbol from tokens the wallet already holds,
+// one candidate per distinct contract address
+func portfolioCandidates(symbol string, holdings []api.TokenBalance) []api.ResolvedToken {
+	candidates := make([]api.ResolvedToken, 0)
+	seen := make(map[string]bool)
+	for _, token := range holdings {
+		address := strings.ToLower(token.TokenAddress)
+		if !strings.EqualFold(token.Symbol, symbol) || address == "" || seen[address] {
+			continue
+		}
+		seen[address] = true
+		candidates = append(candidates, api.ResolvedToken{
+			Symbol:   token.Symbol,
+			Address:  token.TokenAddress,
+			ChainID:  token.Network.ChainID,
+			Network:  token.Network.Slug,
+			Decimals: int(token.Decimals),
+			Source:   SourcePortfolio,
+		})
+	}
+	return candidates
+}
+
+// walletNetworks returns the sorted network slugs the wallet holds assets on
+func walletNetworks(req api.RiskRequest) []string {
+	seen := make(map[string]bool)
+	for _, token := range req.TokenBalances.ByToken {
+		seen[token.Network.Slug] = true
+	}
+	for _, app := range req.AppBalances.ByApp {
+		seen[app.Network.Slug] = true
+	}
+	delete(seen, "")
+
+	networks := make([]string, 0, len(seen))
+	for network := range seen {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	return networks
+}
+
+// holdingsByNetwork groups wallet tokens by network slug
+func holdingsByNetwork(req api.RiskRequest) map[string][]api.TokenBalance {
+	holdings := make(map[string][]api.TokenBalance)
+	for _, token := range req.TokenBalances.ByToken {
+		holdings[token.Network.Slug] = append(holdings[token.Network.Slug], token)
+	}
+	return holdings
+}
@@ -0,0 +1,173 @@
+package tokens
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"dex-analyzer/internal/api"
+)
+
+var (
+	base     = api.Network{Name: "Base", Slug: "base", ChainID: 8453}
+	ethereum = api.Network{Name: "Ethereum", Slug: "ethereum", ChainID: 1}
+	sonic    = api.Network{Name: "Sonic", Slug: "sonic", ChainID: 146}
+)
+
+var testRegistry = NewRegistry([]Token{
+	{Symbol: "USDC", Address: "0xusdc-base", ChainID: 8453, Network: "base", Decimals: 6},
+	{Symbol: "USDC", Address: "0xusdc-eth", ChainID: 1, Network: "ethereum", Decimals: 6},
+	{Symbol: "cbBTC", Address: "0xcbbtc", ChainID: 8453, Network: "base", Decimals: 8, Aliases: []string{"BTC"}},
+	{Symbol: "WBTC", Address: "0xwbtc", ChainID: 1, Network: "ethereum", Decimals: 8, Aliases: []string{"BTC"}},
+	{Symbol: "USDT", Address: "0xusdt-a", ChainID: 8453, Network: "base", Decimals: 6},
+	{Symbol: "USDT", Address: "0xusdt-b", ChainID: 8453, Network: "base", Decimals: 6},
+})
+
+// holding is a wallet token worth 100 USD
+func holding(symbol, address string, network api.Network) api.TokenBalance {
+	return api.TokenBalance{Symbol: symbol, TokenAddress: address, Network: network, Decimals: 18, BalanceUSD: 100}
+}
+
+func TestGuardGround(t *testing.T) {
+	tests := []struct {
+		name        string
+		holdings    []api.TokenBalance
+		recommended []string
+		// resolved lists symbol@network:address/source
+		resolved []string
+		rejected []string
+		kept     []string
+		// flagKept is what flag mode keeps, when it differs from kept
+		flagKept []string
+	}{
+		{
+			name:        "registry",
+			holdings:    []api.TokenBalance{holding("WETH", "0xweth", base)},
+			recommended: []string{"USDC"},
+			resolved:    []string{"USDC@base:0xusdc-base/registry"},
+			kept:        []string{"USDC"},
+		},
+		{
+			name:        "alias on every network",
+			holdings:    []api.TokenBalance{holding("WETH", "0xweth", base), holding("WETH", "0xweth-eth", ethereum)},
+			recommended: []string{"BTC"},
+			resolved:    []string{"cbBTC@base:0xcbbtc/registry", "WBTC@ethereum:0xwbtc/registry"},
+			kept:        []string{"BTC"},
+		},
+		{
+			name:        "held token missing from the registry",
+			holdings:    []api.TokenBalance{holding("DEGEN", "0xdegen", base)},
+			recommended: []string{"degen"},
+			resolved:    []string{"DEGEN@base:0xdegen/portfolio"},
+			kept:        []string{"degen"},
+		},
+		{
+			// The wallet's own contract settles a symbol the registry finds
+			// ambiguous
+			name:        "held token over the registry",
+			holdings:    []api.TokenBalance{holding("USDT", "0xusdt-a", base)},
+			recommended: []string{"USDT"},
+			resolved:    []string{"USDT@base:0xusdt-a/portfolio"},
+			kept:        []string{"USDT"},
+		},
+		{
+			name:        "ambiguous",
+			holdings:    []api.TokenBalance{holding("WETH", "0xweth", base)},
+			recommended: []string{"USDT", "USDC"},
+			resolved:    []string{"USDC@base:0xusdc-base/registry"},
+			rejected:    []string{"USDT: ambiguous symbol on base: 2 candidate contracts"},
+			kept:        []string{"USDC"},
+			flagKept:    []string{"USDT", "USDC"},
+		},
+		{
+			name:        "ambiguous holdings",
+			holdings:    []api.TokenBalance{holding("PEPE", "0xpepe-1", base), holding("PEPE", "0xpepe-2", base), holding("PEPE", "0xPEPE-1", base)},
+			recommended: []string{"PEPE"},
+			rejected:    []string{"PEPE: ambiguous symbol on base: 2 candidate contracts"},
+			kept:        []string{},
+			flagKept:    []string{"PEPE"},
+		},
+		{
+			name:        "unknown",
+			holdings:    []api.TokenBalance{holding("WETH", "0xweth", base)},
+			recommended: []string{"SOL", "USDC"},
+			resolved:    []string{"USDC@base:0xusdc-base/registry"},
+			rejected:    []string{"SOL: unknown token on base"},
+			kept:        []string{"USDC"},
+			flagKept:    []string{"SOL", "USDC"},
+		},
+		{
+			name:        "empty wallet on the default network",
+			recommended: []string{"BTC", "SOL"},
+			resolved:    []string{"cbBTC@base:0xcbbtc/registry"},
+			rejected:    []string{"SOL: unknown token on base"},
+			kept:        []string{"BTC"},
+			flagKept:    []string{"BTC", "SOL"},
+		},
+		{
+			// The registry has nothing on Sonic to tell good symbols from bad
+			name:        "network outside the registry",
+			holdings:    []api.TokenBalance{holding("S", "0xs", sonic)},
+			recommended: []string{"USDC", "S"},
+			resolved:    []string{"S@sonic:0xs/portfolio"},
+			rejected:    []string{"USDC: unverified: the token registry has no tokens on sonic"},
+			kept:        []string{"USDC", "S"},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, drop := range []bool{true, false} {
+			mode := map[bool]string{true: "drop", false: "flag"}[drop]
+			resp := &api.RiskResponse{RecommendedTokens: append([]string(nil), tt.recommended...)}
+			req := api.RiskRequest{Address: "0x1", TokenBalances: api.TokenBalances{ByToken: tt.holdings}}
+			NewGuard(testRegistry, drop, DefaultNetwork).Ground(req, resp)
+
+			kept := tt.kept
+			if !drop && tt.flagKept != nil {
+				kept = tt.flagKept
+			}
+			if !reflect.DeepEqual(resp.RecommendedTokens, kept) {
+				t.Errorf("%s (%s): recommended %q, want %q", tt.name, mode, resp.RecommendedTokens, kept)
+			}
+			if got := resolvedTokens(resp.ResolvedTokens); !reflect.DeepEqual(got, orEmpty(tt.resolved)) {
+				t.Errorf("%s (%s): resolved %q, want %q", tt.name, mode, got, tt.resolved)
+			}
+			if got := rejectedTokens(resp.RejectedTokens); !reflect.DeepEqual(got, orEmpty(tt.rejected)) {
+				t.Errorf("%s (%s): rejected %q, want %q", tt.name, mode, got, tt.rejected)
+			}
+		}
+	}
+}
+
+func TestGuardWithoutDefaultNetwork(t *testing.T) {
+	resp := &api.RiskResponse{RecommendedTokens: []string{"USDC"}}
+	NewGuard(testRegistry, true, "").Ground(api.RiskRequest{Address: "0x1"}, resp)
+
+	if !reflect.DeepEqual(resp.RecommendedTokens, []string{"USDC"}) || len(resp.RejectedTokens) != 1 ||
+		!strings.HasPrefix(resp.RejectedTokens[0].Reason, "unverified") {
+		t.Errorf("empty wallet: recommended %q, rejected %+v; want USDC kept and flagged as unverified", resp.RecommendedTokens, resp.RejectedTokens)
+	}
+}
+
+func resolvedTokens(tokens []api.ResolvedToken) []string {
+	out := make([]string, len(tokens))
+	for i, token := range tokens {
+		out[i] = token.Symbol + "@" + token.Network + ":" + token.Address + "/" + token.Source
+	}
+	return out
+}
+
+func rejectedTokens(tokens []api.RejectedToken) []string {
+	out := make([]string, len(tokens))
+	for i, token := range tokens {
+		out[i] = token.Symbol + ": " + token.Reason
+	}
+	return out
+}
+
+func orEmpty(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
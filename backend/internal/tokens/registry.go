@@ -0,0 +1,98 @@
+// Package tokens resolves token symbols to concrete contracts and grounds
+// LLM token recommendations against that registry.
+package tokens
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//go:embed registry.json
+var defaultRegistry []byte
+
+// Token is a registry entry for a token contract on a single chain
+type Token struct {
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	ChainID  int    `json:"chain_id"`
+	Network  string `json:"network"`
+	Decimals int    `json:"decimals"`
+	// Aliases are alternative tickers, e.g. BTC for the canonical wrapped BTC
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// Registry indexes known tokens by symbol and alias
+type Registry struct {
+	bySymbol map[string][]Token
+	byAlias  map[string][]Token
+	networks map[string]bool
+}
+
+// LoadRegistry reads a registry file, or the bundled registry when path is empty
+func LoadRegistry(path string) (*Registry, error) {
+	data := defaultRegistry
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token registry: %w", err)
+		}
+	}
+
+	var file struct {
+		Tokens []Token `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse token registry: %w", err)
+	}
+
+	return NewRegistry(file.Tokens), nil
+}
+
+// NewRegistry builds a registry from a list of tokens
+func NewRegistry(tokens []Token) *Registry {
+	r := &Registry{
+		bySymbol: make(map[string][]Token),
+		byAlias:  make(map[string][]Token),
+		networks: make(map[string]bool),
+	}
+	for _, token := range tokens {
+		r.networks[strings.ToLower(token.Network)] = true
+		key := strings.ToUpper(token.Symbol)
+		r.bySymbol[key] = append(r.bySymbol[key], token)
+		for _, alias := range token.Aliases {
+			key := strings.ToUpper(alias)
+			r.byAlias[key] = append(r.byAlias[key], token)
+		}
+	}
+	return r
+}
+
+// Lookup returns the tokens matching symbol on network. Exact symbol matches
+// take precedence over aliases.
+func (r *Registry) Lookup(symbol, network string) []Token {
+	key := strings.ToUpper(symbol)
+	if matches := filterNetwork(r.bySymbol[key], network); len(matches) > 0 {
+		return matches
+	}
+	return filterNetwork(r.byAlias[key], network)
+}
+
+// Covers reports whether the registry lists any token on network
+func (r *Registry) Covers(network string) bool {
+	return r.networks[strings.ToLower(network)]
+}
+
+func filterNetwork(tokens []Token, network string) []Token {
+	matches := make([]Token, 0)
+	for _, token := range tokens {
+		if strings.EqualFold(token.Network, network) {
+			matches = append(matches, token)
+		}
+	}
+	return matches
+}
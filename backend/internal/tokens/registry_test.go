@@ -0,0 +1,84 @@
+package tokens
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	registry := NewRegistry([]Token{
+		{Symbol: "USDC", Address: "0xusdc-base", Network: "base"},
+		{Symbol: "USDC", Address: "0xusdc-eth", Network: "ethereum"},
+		{Symbol: "cbBTC", Address: "0xcbbtc", Network: "base", Aliases: []string{"BTC"}},
+		{Symbol: "WBTC", Address: "0xwbtc-eth", Network: "ethereum", Aliases: []string{"BTC"}},
+		// An exact BTC listing outranks the wrapped tokens aliased to BTC
+		{Symbol: "BTC", Address: "0xbtc-eth", Network: "ethereum"},
+	})
+
+	tests := []struct {
+		symbol, network string
+		want            []string
+	}{
+		{symbol: "USDC", network: "base", want: []string{"0xusdc-base"}},
+		{symbol: "usdc", network: "Ethereum", want: []string{"0xusdc-eth"}},
+		{symbol: "USDC", network: "optimism", want: nil},
+		{symbol: "BTC", network: "base", want: []string{"0xcbbtc"}},
+		{symbol: "BTC", network: "ethereum", want: []string{"0xbtc-eth"}},
+		{symbol: "WBTC", network: "ethereum", want: []string{"0xwbtc-eth"}},
+		{symbol: "DOGE", network: "base", want: nil},
+	}
+	for _, tt := range tests {
+		got := registry.Lookup(tt.symbol, tt.network)
+		addresses := make([]string, len(got))
+		for i, token := range got {
+			addresses[i] = token.Address
+		}
+		if len(addresses) != len(tt.want) {
+			t.Errorf("Lookup(%s, %s) = %v, want %v", tt.symbol, tt.network, addresses, tt.want)
+			continue
+		}
+		for i := range addresses {
+			if addresses[i] != tt.want[i] {
+				t.Errorf("Lookup(%s, %s) = %v, want %v", tt.symbol, tt.network, addresses, tt.want)
+			}
+		}
+	}
+
+	for network, want := range map[string]bool{"base": true, "Ethereum": true, "sonic": false} {
+		if got := registry.Covers(network); got != want {
+			t.Errorf("Covers(%s) = %v, want %v", network, got, want)
+		}
+	}
+}
+
+func TestLoadRegistry(t *testing.T) {
+	registry, err := LoadRegistry("")
+	if err != nil {
+		t.Fatalf("bundled registry: %v", err)
+	}
+	for _, network := range []string{"ethereum", "base", "optimism", "polygon", "arbitrum"} {
+		if usdc := registry.Lookup("USDC", network); len(usdc) != 1 || usdc[0].Decimals != 6 {
+			t.Errorf("bundled USDC on %s = %+v, want one 6-decimal contract", network, usdc)
+		}
+	}
+
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "tokens.json")
+	os.WriteFile(custom, []byte(`{"tokens": [{"symbol": "AERO", "address": "0xaero", "chain_id": 8453, "network": "base", "decimals": 18}]}`), 0o644)
+	registry, err = LoadRegistry(custom)
+	if err != nil {
+		t.Fatalf("custom registry: %v", err)
+	}
+	if aero := registry.Lookup("AERO", "base"); len(aero) != 1 || registry.Covers("ethereum") {
+		t.Errorf("custom registry = %+v, want only its own tokens", aero)
+	}
+
+	broken := filepath.Join(dir, "broken.json")
+	os.WriteFile(broken, []byte(`{"tokens": [`), 0o644)
+	for _, path := range []string{broken, filepath.Join(dir, "missing.json")} {
+		if _, err := LoadRegistry(path); err == nil {
+			t.Errorf("LoadRegistry(%s) succeeded, want an error", filepath.Base(path))
+		}
+	}
+}
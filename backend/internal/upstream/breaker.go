@@ -0,0 +1,79 @@
+package upstream
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a consecutive-failure circuit breaker. Once open it rejects
+// requests until the cooldown has passed, then lets a single trial request
+// through: success closes the circuit, failure opens it again.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// allow reports whether a request may be sent
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if time.Since(b.openedAt) < b.cooldown || b.trial {
+		return ErrCircuitOpen
+	}
+	b.trial = true
+	return nil
+}
+
+// minRetryAfter is suggested once the cooldown is over but a trial request
+// is still running, since its outcome decides whether the circuit closes
+const minRetryAfter = time.Second
+
+// retryAfter is the remaining cooldown of an open breaker, and at least
+// minRetryAfter
+func (b *breaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	remaining := b.cooldown - time.Since(b.openedAt)
+	if remaining < minRetryAfter {
+		return minRetryAfter
+	}
+	return remaining
+}
+
+// release ends a trial without a verdict, as when its caller gave up, so that
+// the next request becomes the trial
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,87 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerCancelledTrialReleasesCircuit(t *testing.T) {
+	// 0: fail, 1: hang until the caller gives up, otherwise succeed
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			<-r.Context().Done()
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	cooldown := 20 * time.Millisecond
+	client := NewClient(Config{Name: "test", MaxAttempts: 1, FailureThreshold: 1, Cooldown: cooldown})
+	send := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Do(req)
+		return err
+	}
+
+	var statusErr *StatusError
+	if err := send(context.Background()); !errors.As(err, &statusErr) {
+		t.Fatalf("first request: got %v, want a StatusError", err)
+	}
+	if err := send(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("request during cooldown: got %v, want ErrCircuitOpen", err)
+	}
+
+	time.Sleep(cooldown)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := send(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("cancelled trial: got %v, want context.DeadlineExceeded", err)
+	}
+
+	if err := send(context.Background()); err != nil {
+		t.Fatalf("request after cancelled trial: got %v, want the next trial to go through", err)
+	}
+	if err := send(context.Background()); err != nil {
+		t.Fatalf("request after successful trial: got %v, want a closed circuit", err)
+	}
+}
+
+func TestBreakerFailedTrialReopensCircuit(t *testing.T) {
+	b := &breaker{threshold: 1, cooldown: time.Hour}
+	b.failure()
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker: got %v, want ErrCircuitOpen", err)
+	}
+
+	b.openedAt = time.Now().Add(-time.Hour)
+	if err := b.allow(); err != nil {
+		t.Fatalf("after cooldown: got %v, want a trial", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("during trial: got %v, want ErrCircuitOpen", err)
+	}
+	if got := b.retryAfter(); got != minRetryAfter {
+		t.Errorf("retry after during trial = %s, want %s", got, minRetryAfter)
+	}
+
+	b.failure()
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("after failed trial: got %v, want ErrCircuitOpen", err)
+	}
+	if got := b.retryAfter(); got <= time.Hour-time.Minute || got > time.Hour {
+		t.Errorf("retry after failed trial = %s, want the new cooldown", got)
+	}
+}
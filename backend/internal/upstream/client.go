@@ -0,0 +1,288 @@
+// Package upstream is the shared HTTP client for third-party APIs (Zapper,
+// ASI:One and other LLM servers, the risk advisor agent). It bounds every
+// attempt with a timeout, retries 429 and 5xx responses with exponential
+// backoff and jitter while honoring Retry-After, and trips a per-upstream
+// circuit breaker when an upstream keeps failing.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults used when the corresponding Config field is zero
+const (
+	DefaultTimeout          = 15 * time.Second
+	DefaultMaxAttempts      = 3
+	DefaultBaseDelay        = 250 * time.Millisecond
+	DefaultMaxDelay         = 5 * time.Second
+	DefaultFailureThreshold = 5
+	DefaultCooldown         = 30 * time.Second
+)
+
+// maxErrorBody caps how much of an error response is kept for diagnostics
+const maxErrorBody = 512
+
+// Config configures a Client for one upstream
+type Config struct {
+	// Name identifies the upstream in errors and logs, e.g. "zapper"
+	Name string
+	// Timeout bounds each attempt, including reading the response body
+	Timeout time.Duration
+	// MaxAttempts is the number of tries for retryable failures
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; it doubles on every
+	// further retry up to MaxDelay. A Retry-After longer than MaxDelay is not
+	// waited for.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// FailureThreshold is the number of consecutive failed attempts that
+	// opens the circuit breaker
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before a trial request
+	Cooldown time.Duration
+}
+
+// StatusError is a non-2xx response. Body holds the start of the response
+// for logs and must not be shown to API clients.
+type StatusError struct {
+	Upstream   string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned HTTP %d: %s", e.Upstream, e.StatusCode, e.Body)
+}
+
+// ErrCircuitOpen is matched by CircuitOpenError with errors.Is
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned without contacting the upstream while its
+// circuit breaker is open
+type CircuitOpenError struct {
+	Upstream string
+	// RetryAfter is when the breaker lets a trial request through
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s is unavailable: %v, retry in %s", e.Upstream, ErrCircuitOpen, e.RetryAfter.Round(time.Second))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Client sends requests to a single upstream
+type Client struct {
+	name        string
+	timeout     time.Duration
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	breaker     *breaker
+	http        *http.Client
+}
+
+// NewClient creates a client with its own circuit breaker
+func NewClient(cfg Config) *Client {
+	c := &Client{
+		name:        cfg.Name,
+		timeout:     cfg.Timeout,
+		maxAttempts: cfg.MaxAttempts,
+		baseDelay:   cfg.BaseDelay,
+		maxDelay:    cfg.MaxDelay,
+		http:        &http.Client{},
+	}
+	if c.name == "" {
+		c.name = "upstream"
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	if c.maxAttempts <= 0 {
+		c.maxAttempts = DefaultMaxAttempts
+	}
+	if c.baseDelay <= 0 {
+		c.baseDelay = DefaultBaseDelay
+	}
+	if c.maxDelay <= 0 {
+		c.maxDelay = DefaultMaxDelay
+	}
+
+	threshold := cfg.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+	cooldown := cfg.Cooldown
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	c.breaker = &breaker{threshold: threshold, cooldown: cooldown}
+
+	return c
+}
+
+// Name is the upstream name errors are reported with
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Do sends req and returns the body of a 2xx response. Other responses are
+// returned as *StatusError after any retries. Requests with a body must be
+// rewindable, which http.NewRequest arranges for in-memory bodies.
+func (c *Client) Do(req *http.Request) ([]byte, error) {
+	ctx := req.Context()
+
+	var lastErr error
+	for attempt := 1; attempt <= c.maxAttempts; attempt++ {
+		if err := c.breaker.allow(); err != nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w (last error: %v)", &CircuitOpenError{Upstream: c.name, RetryAfter: c.breaker.retryAfter()}, lastErr)
+			}
+			return nil, &CircuitOpenError{Upstream: c.name, RetryAfter: c.breaker.retryAfter()}
+		}
+
+		body, retryAfter, err := c.attempt(req, attempt)
+		if err == nil {
+			c.breaker.success()
+			return body, nil
+		}
+		lastErr = err
+
+		retryable := isRetryable(err)
+		switch {
+		case ctx.Err() != nil:
+			// The caller gave up; that says nothing about the upstream
+			c.breaker.release()
+		case retryable:
+			c.breaker.failure()
+		default:
+			// The upstream answered; a 4xx is not its fault
+			c.breaker.success()
+		}
+		if !retryable || attempt == c.maxAttempts || ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay := c.backoff(attempt)
+		if retryAfter > 0 {
+			if retryAfter > c.maxDelay {
+				return nil, err
+			}
+			delay = retryAfter
+		}
+		log.Printf("%s attempt %d/%d failed: %v; retrying in %s", c.name, attempt, c.maxAttempts, err, delay.Round(time.Millisecond))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%s request cancelled while retrying: %w", c.name, ctx.Err())
+		case <-timer.C:
+		}
+	}
+	return nil, lastErr
+}
+
+// attempt sends one try of req, returning the body of a 2xx response or the
+// error and any Retry-After delay of the response
+func (c *Client) attempt(req *http.Request, attempt int) ([]byte, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), c.timeout)
+	defer cancel()
+
+	try := req.Clone(ctx)
+	if attempt > 1 && req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, 0, fmt.Errorf("%s request body cannot be replayed", c.name)
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to replay %s request body: %w", c.name, err)
+		}
+		try.Body = body
+	}
+
+	resp, err := c.http.Do(try)
+	if err != nil {
+		return nil, 0, &transportError{upstream: c.name, err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, &transportError{upstream: c.name, err: err}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet := body
+		if len(snippet) > maxErrorBody {
+			snippet = snippet[:maxErrorBody]
+		}
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), &StatusError{
+			Upstream:   c.name,
+			StatusCode: resp.StatusCode,
+			Body:       string(snippet),
+		}
+	}
+	return body, 0, nil
+}
+
+// backoff is the jittered exponential delay before retry number attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.baseDelay << (attempt - 1)
+	if delay <= 0 || delay > c.maxDelay {
+		delay = c.maxDelay
+	}
+	// Equal jitter: half fixed, half random
+	half := delay / 2
+	return half + time.Duration(rand.Int64N(int64(half)+1))
+}
+
+// transportError is a failure to get a response at all, including timeouts
+type transportError struct {
+	upstream string
+	err      error
+}
+
+func (e *transportError) Error() string {
+	return fmt.Sprintf("%s request failed: %v", e.upstream, e.err)
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable reports whether another attempt may succeed
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var transportErr *transportError
+	return errors.As(err, &transportErr)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
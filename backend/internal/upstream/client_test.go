@@ -0,0 +1,143 @@
+package upstream
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptedServer answers with the statuses in order, repeating the last one,
+// and counts the requests it receives
+func scriptedServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		if status != http.StatusOK && retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(http.StatusText(status)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func get(t *testing.T, client *Client, url string) ([]byte, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.Do(req)
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		calls    int32
+		status   int
+	}{
+		{name: "server errors", statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK}, calls: 3},
+		{name: "rate limited", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, calls: 2},
+		{name: "client error", statuses: []int{http.StatusNotFound}, calls: 1, status: http.StatusNotFound},
+		{name: "attempts exhausted", statuses: []int{http.StatusServiceUnavailable}, calls: DefaultMaxAttempts, status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		srv, calls := scriptedServer(t, "", tt.statuses...)
+		client := NewClient(Config{Name: "test", BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+
+		body, err := get(t, client, srv.URL)
+		if got := calls.Load(); got != tt.calls {
+			t.Errorf("%s: %d requests, want %d", tt.name, got, tt.calls)
+		}
+		if tt.status == 0 {
+			if err != nil || string(body) != "OK" {
+				t.Errorf("%s: got %q, %v; want the OK body", tt.name, body, err)
+			}
+			continue
+		}
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status || statusErr.Upstream != "test" {
+			t.Errorf("%s: got %v, want a %d StatusError from test", tt.name, err, tt.status)
+		}
+	}
+}
+
+func TestClientHonorsRetryAfter(t *testing.T) {
+	srv, calls := scriptedServer(t, "1", http.StatusTooManyRequests, http.StatusOK)
+	client := NewClient(Config{Name: "test", BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second})
+
+	start := time.Now()
+	if _, err := get(t, client, srv.URL); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || calls.Load() != 2 {
+		t.Errorf("retried after %s in %d requests, want the 1s Retry-After waited for", elapsed, calls.Load())
+	}
+}
+
+func TestClientDoesNotWaitPastMaxDelay(t *testing.T) {
+	srv, calls := scriptedServer(t, "60", http.StatusTooManyRequests, http.StatusOK)
+	client := NewClient(Config{Name: "test", BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+
+	start := time.Now()
+	_, err := get(t, client, srv.URL)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got %v, want the 429 returned", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || calls.Load() != 1 {
+		t.Errorf("gave up after %s and %d requests, want no retry", elapsed, calls.Load())
+	}
+}
+
+func TestClientBackoff(t *testing.T) {
+	client := NewClient(Config{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	tests := []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{attempt: 1, delay: 100 * time.Millisecond},
+		{attempt: 2, delay: 200 * time.Millisecond},
+		{attempt: 4, delay: 800 * time.Millisecond},
+		{attempt: 5, delay: time.Second},
+		// Shifted past the width of a Duration
+		{attempt: 70, delay: time.Second},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			// Equal jitter keeps at least half the delay
+			if got := client.backoff(tt.attempt); got < tt.delay/2 || got > tt.delay {
+				t.Errorf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, got, tt.delay/2, tt.delay)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{value: ""},
+		{value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{value: "0"},
+		{value: "-5"},
+		{value: "soon"},
+		{value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+		{value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want within [%s, %s]", tt.value, got, tt.min, tt.max)
+		}
+	}
+}